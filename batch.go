@@ -0,0 +1,410 @@
+package resvg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SkipMode how `ConvertDir` decides that the outputs of an SVG are up to date.
+type SkipMode int
+
+const (
+	// SkipByModTime skips an SVG whose outputs are all newer than it.
+	SkipByModTime SkipMode = iota
+	// SkipByHash skips an SVG whose content, options, sizes and fonts are unchanged
+	// since its last conversion, as recorded in the `BatchManifest` of the destination.
+	SkipByHash
+	// SkipNone converts every SVG.
+	SkipNone
+)
+
+// BatchManifest the file in the destination of `ConvertDir` recording the hashes of `SkipByHash`.
+const BatchManifest = ".resvg-go-batch.json"
+
+// BatchSize an output size of each SVG.
+type BatchSize struct {
+	// Suffix appended to the name of the output, such as `@2x`.
+	Suffix string
+	// Width and Height fit the image inside, keeping its aspect ratio.
+	// Zero keeps the size of the SVG.
+	Width  uint32
+	Height uint32
+	// Zoom scales the fitted image, such as 2 for `@2x`.
+	// Default: 1
+	Zoom float32
+}
+
+// BatchOptions the options of `ConvertDir`.
+type BatchOptions struct {
+	// Options used to parse each SVG.
+	// An empty `ResourcesDir` is the directory of the SVG.
+	Options *Options
+
+	// Sizes the outputs of each SVG.
+	// Default: a single output of the SVG size without suffix.
+	Sizes []BatchSize
+
+	// Pool renders the SVGs, fonts are taken from the `FontDB` of its workers.
+	// Default: a new pool of `Workers` workers without fonts.
+	Pool *Pool
+
+	// Workers the size of the default pool.
+	// Default: `runtime.NumCPU()`
+	Workers int
+
+	// Skip how up to date outputs are skipped.
+	// Default: SkipByModTime
+	Skip SkipMode
+}
+
+// BatchReport the result of `ConvertDir`, can be marshaled as JSON.
+type BatchReport struct {
+	Converted int            `json:"converted"`
+	Skipped   int            `json:"skipped"`
+	Failures  []BatchFailure `json:"failures"`
+	Warnings  []BatchWarning `json:"warnings"`
+}
+
+// BatchFailure an SVG that failed to convert.
+type BatchFailure struct {
+	// Path relative to the source directory.
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// BatchWarning an SVG converted with fonts or glyphs missing.
+type BatchWarning struct {
+	// Path relative to the source directory.
+	Path string                `json:"path"`
+	Text *TextConversionReport `json:"text"`
+}
+
+// ConvertDir converts the `.svg` and `.svgz` files in the tree of src into PNGs
+// of the same relative paths in dst, one per size, in parallel across the pool.
+// Failures of single SVGs are listed in the report, and SVGs converted with fonts
+// or glyphs missing in its warnings, the error is returned only
+// when the walk fails or the ctx is done. SVGs of the same path but the extension,
+// such as `a.svg` and `a.svgz`, are failures as their outputs would collide.
+func ConvertDir(ctx context.Context, src string, dst string, opts BatchOptions) (*BatchReport, error) {
+	pool := opts.Pool
+	if pool == nil {
+		var err error
+		pool, err = NewPool(ctx, PoolOptions{Size: opts.Workers})
+		if err != nil {
+			return nil, err
+		}
+		defer pool.Close()
+	}
+	if len(opts.Sizes) == 0 {
+		opts.Sizes = []BatchSize{{}}
+	}
+	var files []string
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".svg", ".svgz":
+			if !d.IsDir() {
+				rel, err := filepath.Rel(src, path)
+				if err != nil {
+					return err
+				}
+				files = append(files, rel)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	b := &batch{
+		pool:     pool,
+		src:      src,
+		dst:      dst,
+		opts:     opts,
+		report:   &BatchReport{Failures: []BatchFailure{}, Warnings: []BatchWarning{}},
+		manifest: map[string]string{},
+	}
+	if opts.Skip == SkipByHash {
+		b.loadManifest()
+	}
+	files = b.dropCollisions(files)
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < pool.Size(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rel := range jobs {
+				b.convert(ctx, rel)
+			}
+		}()
+	}
+feed:
+	for _, rel := range files {
+		select {
+		case <-ctx.Done():
+			break feed
+		case jobs <- rel:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	sort.Slice(b.report.Failures, func(i, j int) bool {
+		return b.report.Failures[i].Path < b.report.Failures[j].Path
+	})
+	sort.Slice(b.report.Warnings, func(i, j int) bool {
+		return b.report.Warnings[i].Path < b.report.Warnings[j].Path
+	})
+	if opts.Skip == SkipByHash {
+		err = b.saveManifest()
+		if err != nil {
+			return b.report, err
+		}
+	}
+	return b.report, ctx.Err()
+}
+
+// batch the state of a `ConvertDir`.
+type batch struct {
+	pool *Pool
+	src  string
+	dst  string
+	opts BatchOptions
+
+	// mu guards report and manifest.
+	mu       sync.Mutex
+	report   *BatchReport
+	manifest map[string]string
+}
+
+func (b *batch) loadManifest() {
+	data, err := os.ReadFile(filepath.Join(b.dst, BatchManifest))
+	if err != nil {
+		return
+	}
+	json.Unmarshal(data, &b.manifest)
+}
+
+func (b *batch) saveManifest() error {
+	data, err := json.MarshalIndent(b.manifest, "", "\t")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(b.dst, 0o755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(b.dst, BatchManifest), data, 0o644)
+}
+
+// dropCollisions reports the SVGs whose outputs would overwrite each other,
+// such as `a.svg` and `a.svgz`, as failures and returns the others.
+func (b *batch) dropCollisions(files []string) []string {
+	byBase := make(map[string][]string)
+	for _, rel := range files {
+		base := strings.TrimSuffix(rel, filepath.Ext(rel))
+		byBase[base] = append(byBase[base], rel)
+	}
+	kept := files[:0]
+	for _, rel := range files {
+		same := byBase[strings.TrimSuffix(rel, filepath.Ext(rel))]
+		if len(same) == 1 {
+			kept = append(kept, rel)
+			continue
+		}
+		var others []string
+		for _, other := range same {
+			if other != rel {
+				others = append(others, filepath.ToSlash(other))
+			}
+		}
+		key := filepath.ToSlash(rel)
+		delete(b.manifest, key)
+		b.report.Failures = append(b.report.Failures, BatchFailure{
+			Path:  key,
+			Error: "outputs collide with " + strings.Join(others, ", "),
+		})
+	}
+	return kept
+}
+
+// convert converts an SVG and records the result.
+func (b *batch) convert(ctx context.Context, rel string) {
+	skipped, hash, text, err := b.convertFile(ctx, rel)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := filepath.ToSlash(rel)
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+	case err != nil:
+		delete(b.manifest, key)
+		b.report.Failures = append(b.report.Failures, BatchFailure{Path: key, Error: err.Error()})
+	case skipped:
+		b.report.Skipped++
+	default:
+		b.manifest[key] = hash
+		b.report.Converted++
+		if !text.Empty() {
+			b.report.Warnings = append(b.report.Warnings, BatchWarning{Path: key, Text: text})
+		}
+	}
+}
+
+func (b *batch) convertFile(ctx context.Context, rel string) (bool, string, *TextConversionReport, error) {
+	path := filepath.Join(b.src, rel)
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, "", nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, "", nil, err
+	}
+	options := Options{}
+	if b.opts.Options != nil {
+		options = *b.opts.Options
+	}
+	if options.ResourcesDir == "" {
+		options.ResourcesDir = filepath.Dir(path)
+	}
+	base := strings.TrimSuffix(rel, filepath.Ext(rel))
+	outputs := make([]string, len(b.opts.Sizes))
+	for i, size := range b.opts.Sizes {
+		outputs[i] = filepath.Join(b.dst, base+size.Suffix+".png")
+	}
+	hash := batchHash(data, b.opts.Options, b.opts.Sizes, b.pool.FontFingerprint())
+	if b.upToDate(filepath.ToSlash(rel), info, hash, outputs) {
+		return true, hash, nil, nil
+	}
+	pngs := make([][]byte, len(b.opts.Sizes))
+	var text *TextConversionReport
+	err = b.pool.Do(ctx, func(wk *Worker, fontdb *FontDB) error {
+		tree, err := wk.NewTreeFromData(data, &options)
+		if err != nil {
+			return err
+		}
+		defer tree.Close()
+		text, err = tree.ConvertText(fontdb)
+		if err != nil {
+			return err
+		}
+		w, h, err := tree.GetSize()
+		if err != nil {
+			return err
+		}
+		for i, size := range b.opts.Sizes {
+			pngs[i], err = renderSize(wk, tree, w, h, size)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, "", nil, err
+	}
+	for i, output := range outputs {
+		err = os.MkdirAll(filepath.Dir(output), 0o755)
+		if err != nil {
+			return false, "", nil, err
+		}
+		err = os.WriteFile(output, pngs[i], 0o644)
+		if err != nil {
+			return false, "", nil, err
+		}
+	}
+	return false, hash, text, nil
+}
+
+// upToDate reports whether the outputs of an SVG can be skipped.
+func (b *batch) upToDate(key string, info fs.FileInfo, hash string, outputs []string) bool {
+	switch b.opts.Skip {
+	case SkipByModTime:
+		for _, output := range outputs {
+			out, err := os.Stat(output)
+			if err != nil || out.ModTime().Before(info.ModTime()) {
+				return false
+			}
+		}
+		return true
+	case SkipByHash:
+		b.mu.Lock()
+		old := b.manifest[key]
+		b.mu.Unlock()
+		if old != hash {
+			return false
+		}
+		for _, output := range outputs {
+			_, err := os.Stat(output)
+			if err != nil {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// batchHash the hash of an SVG with the options, the sizes of its outputs and the fonts.
+func batchHash(data []byte, options *Options, sizes []BatchSize, fonts string) string {
+	h := sha256.New()
+	h.Write(data)
+	params, _ := json.Marshal(struct {
+		Options *Options
+		Sizes   []BatchSize
+		Fonts   string
+	}{options, sizes, fonts})
+	h.Write(params)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// renderSize renders the tree of the size (w, h) into a PNG of the batch size.
+func renderSize(wk *Worker, tree *Tree, w float32, h float32, size BatchSize) ([]byte, error) {
+	scale, width, height := fitSize(w, h, size)
+	if width == 0 || height == 0 {
+		return nil, ErrEmptySize
+	}
+	pixmap, err := wk.NewPixmap(width, height)
+	if err != nil {
+		return nil, err
+	}
+	defer pixmap.Close()
+	err = tree.Render(TransformFromScale(scale, scale), pixmap)
+	if err != nil {
+		return nil, err
+	}
+	return pixmap.EncodePNG()
+}
+
+// fitSize returns the scale and the size in pixels of the size (w, h) fitted into the batch size.
+func fitSize(w float32, h float32, size BatchSize) (float32, uint32, uint32) {
+	if w <= 0 || h <= 0 {
+		return 0, 0, 0
+	}
+	scale := float32(1)
+	switch {
+	case size.Width > 0 && size.Height > 0:
+		scale = float32(math.Min(float64(size.Width)/float64(w), float64(size.Height)/float64(h)))
+	case size.Width > 0:
+		scale = float32(size.Width) / w
+	case size.Height > 0:
+		scale = float32(size.Height) / h
+	}
+	if size.Zoom > 0 {
+		scale *= size.Zoom
+	}
+	return scale, uint32(math.Ceil(float64(w * scale))), uint32(math.Ceil(float64(h * scale)))
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	resvg "github.com/kanrichan/resvg-go"
+)
+
+// runBatch converts the SVGs of a directory tree by `resvg.ConvertDir`.
+func runBatch(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) error {
+	fset := flag.NewFlagSet("resvg-go batch", flag.ContinueOnError)
+	fset.SetOutput(stderr)
+	fset.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: resvg-go batch [flags] <src-dir> <dst-dir>")
+		fset.PrintDefaults()
+	}
+	cfg := newConfig(fset)
+	scales := fset.String("scales", "1", "comma-separated scales of the outputs, named like name@2x.png")
+	workers := fset.Int("workers", 0, "number of workers (default number of CPUs)")
+	skip := fset.String("skip", "mtime", "skip up to date outputs by mtime, hash or none")
+	report := fset.String("report", "", "write the JSON report to the file (default stdout)")
+	err := fset.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fset.NArg() != 2 {
+		fset.Usage()
+		return flag.ErrHelp
+	}
+	opts := resvg.BatchOptions{Workers: *workers}
+	opts.Options, err = cfg.options(cfg.resourcesDir)
+	if err != nil {
+		return err
+	}
+	opts.Sizes, err = batchSizes(*scales, cfg)
+	if err != nil {
+		return err
+	}
+	switch *skip {
+	case "mtime":
+		opts.Skip = resvg.SkipByModTime
+	case "hash":
+		opts.Skip = resvg.SkipByHash
+	case "none":
+		opts.Skip = resvg.SkipNone
+	default:
+		return fmt.Errorf("unsupported skip %q", *skip)
+	}
+	// warn about the fonts once rather than once per worker
+	var once sync.Once
+	opts.Pool, err = resvg.NewPool(ctx, resvg.PoolOptions{
+		Size: *workers,
+		LoadFonts: func(db *resvg.FontDB) error {
+			w := io.Discard
+			once.Do(func() { w = stderr })
+			return cfg.loadFonts(db, w)
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer opts.Pool.Close()
+	result, err := resvg.ConvertDir(ctx, fset.Arg(0), fset.Arg(1), opts)
+	if result != nil {
+		data, err := json.MarshalIndent(result, "", "\t")
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+		if *report == "" {
+			_, err = stdout.Write(data)
+		} else {
+			err = os.WriteFile(*report, data, 0o644)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(result.Failures) != 0 {
+		return fmt.Errorf("%d files failed", len(result.Failures))
+	}
+	return nil
+}
+
+// batchSizes returns the sizes of the comma-separated scales,
+// the output of the scale 1 has no suffix.
+func batchSizes(scales string, cfg *config) ([]resvg.BatchSize, error) {
+	var sizes []resvg.BatchSize
+	for _, s := range strings.Split(scales, ",") {
+		s = strings.TrimSuffix(strings.TrimSpace(s), "x")
+		zoom, err := strconv.ParseFloat(s, 32)
+		if err != nil || zoom <= 0 {
+			return nil, errors.New("invalid scale " + strconv.Quote(s))
+		}
+		size := resvg.BatchSize{
+			Width:  uint32(cfg.width),
+			Height: uint32(cfg.height),
+			Zoom:   float32(zoom),
+		}
+		if zoom != 1 {
+			size.Suffix = "@" + s + "x"
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+
+	resvg "github.com/kanrichan/resvg-go"
+)
+
+// config the flags of the rendering.
+type config struct {
+	width      int
+	height     int
+	zoom       float64
+	dpi        float64
+	background string
+
+	fontFiles       stringList
+	fontDirs        stringList
+	systemFonts     bool
+	bundledFonts    bool
+	fontFamily      string
+	fontSize        float64
+	serifFamily     string
+	sansSerifFamily string
+	cursiveFamily   string
+	fantasyFamily   string
+	monospaceFamily string
+
+	resourcesDir   string
+	exportID       string
+	languages      string
+	shapeRendering string
+	textRendering  string
+	imageRendering string
+
+	format  string
+	quality int
+}
+
+// newConfig defines the flags of the parsing and the fonts on the flag set.
+func newConfig(fset *flag.FlagSet) *config {
+	cfg := &config{}
+	fset.IntVar(&cfg.width, "w", 0, "output width in pixels, keeps the aspect ratio")
+	fset.IntVar(&cfg.height, "h", 0, "output height in pixels, keeps the aspect ratio")
+	fset.Float64Var(&cfg.dpi, "dpi", 96, "resolution used for units conversion")
+
+	fset.Var(&cfg.fontFiles, "font-file", "load a font file, can be repeated")
+	fset.Var(&cfg.fontDirs, "font-dir", "load the font files of a directory, can be repeated")
+	fset.BoolVar(&cfg.systemFonts, "system-fonts", false, "load the fonts of the host, which is slow for many fonts")
+	fset.BoolVar(&cfg.bundledFonts, "bundled-fonts", false, "load the bundled fonts and use them as generic families")
+	fset.StringVar(&cfg.fontFamily, "font-family", "", "default font family (default Times New Roman)")
+	fset.Float64Var(&cfg.fontSize, "font-size", 0, "default font size (default 12)")
+	fset.StringVar(&cfg.serifFamily, "serif-family", "", "font family of serif (default Times New Roman)")
+	fset.StringVar(&cfg.sansSerifFamily, "sans-serif-family", "", "font family of sans-serif (default Arial)")
+	fset.StringVar(&cfg.cursiveFamily, "cursive-family", "", "font family of cursive (default Comic Sans MS)")
+	fset.StringVar(&cfg.fantasyFamily, "fantasy-family", "", "font family of fantasy (default Impact)")
+	fset.StringVar(&cfg.monospaceFamily, "monospace-family", "", "font family of monospace (default Courier New)")
+
+	fset.StringVar(&cfg.resourcesDir, "resources-dir", "", "directory of the relative paths (default directory of the input)")
+	fset.StringVar(&cfg.languages, "languages", "", "comma-separated languages for systemLanguage (default en)")
+	fset.StringVar(&cfg.shapeRendering, "shape-rendering", "", "default shape rendering: optimizeSpeed, crispEdges or geometricPrecision")
+	fset.StringVar(&cfg.textRendering, "text-rendering", "", "default text rendering: optimizeSpeed, optimizeLegibility or geometricPrecision")
+	fset.StringVar(&cfg.imageRendering, "image-rendering", "", "default image rendering: optimizeQuality or optimizeSpeed")
+	return cfg
+}
+
+// outputFlags defines the flags of a single output on the flag set.
+func (cfg *config) outputFlags(fset *flag.FlagSet) {
+	fset.Float64Var(&cfg.zoom, "zoom", 0, "zoom the image by a factor")
+	fset.StringVar(&cfg.background, "background", "", "background color, such as #fff or #ffffff80")
+	fset.StringVar(&cfg.exportID, "export-id", "", "render only the element of the id, cropped to its bounding box")
+	fset.StringVar(&cfg.format, "format", "", "output format: png or jpeg (default by the output extension, png)")
+	fset.IntVar(&cfg.quality, "quality", 90, "jpeg quality from 1 to 100")
+}
+
+// stringList a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// options maps the config onto `resvg.Options`.
+func (cfg *config) options(resourcesDir string) (*resvg.Options, error) {
+	opts := &resvg.Options{
+		ResourcesDir: resourcesDir,
+		Dpi:          float32(cfg.dpi),
+		FontFamily:   cfg.fontFamily,
+		FontSize:     float32(cfg.fontSize),
+	}
+	if cfg.languages != "" {
+		opts.Languages = strings.Split(cfg.languages, ",")
+	}
+	switch cfg.shapeRendering {
+	case "":
+	case "optimizeSpeed":
+		opts.ShapeRenderingMode = resvg.ShapeRenderingModeOptimizeSpeed
+	case "crispEdges":
+		opts.ShapeRenderingMode = resvg.ShapeRenderingModeCrispEdges
+	case "geometricPrecision":
+		opts.ShapeRenderingMode = resvg.ShapeRenderingModeGeometricPrecision
+	default:
+		return nil, fmt.Errorf("unsupported shape-rendering %q", cfg.shapeRendering)
+	}
+	switch cfg.textRendering {
+	case "":
+	case "optimizeSpeed":
+		opts.TextRenderingMode = resvg.TextRenderingModeOptimizeSpeed
+	case "optimizeLegibility":
+		opts.TextRenderingMode = resvg.TextRenderingModeOptimizeLegibility
+	case "geometricPrecision":
+		opts.TextRenderingMode = resvg.TextRenderingModeGeometricPrecision
+	default:
+		return nil, fmt.Errorf("unsupported text-rendering %q", cfg.textRendering)
+	}
+	switch cfg.imageRendering {
+	case "":
+	case "optimizeQuality":
+		opts.ImageRenderingMode = resvg.ImageRenderingModeOptimizeQuality
+	case "optimizeSpeed":
+		opts.ImageRenderingMode = resvg.ImageRenderingModeOptimizeSpeed
+	default:
+		return nil, fmt.Errorf("unsupported image-rendering %q", cfg.imageRendering)
+	}
+	return opts, nil
+}
+
+// outputFormat returns the format of the output file.
+func (cfg *config) outputFormat(out string) (string, error) {
+	format := cfg.format
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(out)) {
+		case ".jpg", ".jpeg":
+			format = "jpeg"
+		default:
+			format = "png"
+		}
+	}
+	switch format {
+	case "png", "jpeg":
+		return format, nil
+	case "jpg":
+		return "jpeg", nil
+	default:
+		return "", fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// fit returns the scale and the size of the image of the size (w, h).
+func (cfg *config) fit(w float32, h float32) (float32, uint32, uint32, error) {
+	if w <= 0 || h <= 0 {
+		return 0, 0, 0, errors.New("image has no size")
+	}
+	scale := float32(1)
+	switch {
+	case cfg.zoom > 0:
+		scale = float32(cfg.zoom)
+	case cfg.width > 0 && cfg.height > 0:
+		scale = float32(math.Min(float64(cfg.width)/float64(w), float64(cfg.height)/float64(h)))
+	case cfg.width > 0:
+		scale = float32(cfg.width) / w
+	case cfg.height > 0:
+		scale = float32(cfg.height) / h
+	}
+	width := uint32(math.Ceil(float64(w * scale)))
+	height := uint32(math.Ceil(float64(h * scale)))
+	if width == 0 || height == 0 {
+		return 0, 0, 0, errors.New("image has no size")
+	}
+	return scale, width, height, nil
+}
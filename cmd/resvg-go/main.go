@@ -0,0 +1,98 @@
+// Command resvg-go renders SVG and SVGZ files to PNG or JPEG like the resvg CLI.
+//
+// Usage:
+//
+//	resvg-go [flags] <in.svg|-> <out.png|->
+//	resvg-go batch [flags] <src-dir> <dst-dir>
+//	resvg-go watch [flags] <src-dir> <dst-dir>
+//
+// `-` reads the SVG from stdin or writes the image to stdout.
+// `batch` converts the SVGs of a directory tree and prints a JSON report.
+// `watch` re-renders the changed SVGs of a directory tree until interrupted.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	err := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "resvg-go:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	if len(args) != 0 {
+		switch args[0] {
+		case "batch":
+			return runBatch(ctx, args[1:], stdout, stderr)
+		case "watch":
+			return runWatch(ctx, args[1:], stderr)
+		}
+	}
+	fset := flag.NewFlagSet("resvg-go", flag.ContinueOnError)
+	fset.SetOutput(stderr)
+	fset.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: resvg-go [flags] <in.svg|-> <out.png|->")
+		fset.PrintDefaults()
+	}
+	cfg := newConfig(fset)
+	cfg.outputFlags(fset)
+	err := fset.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fset.NArg() != 2 {
+		fset.Usage()
+		return flag.ErrHelp
+	}
+	in, out := fset.Arg(0), fset.Arg(1)
+	var svg []byte
+	resourcesDir := cfg.resourcesDir
+	if in == "-" {
+		svg, err = io.ReadAll(stdin)
+	} else {
+		svg, err = os.ReadFile(in)
+		if resourcesDir == "" {
+			resourcesDir = filepath.Dir(in)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	format, err := cfg.outputFormat(out)
+	if err != nil {
+		return err
+	}
+	r, err := newRenderer(ctx, cfg, stderr)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	data, report, err := r.render(svg, resourcesDir, format)
+	if err != nil {
+		return err
+	}
+	if !report.Empty() {
+		fmt.Fprintln(stderr, "resvg-go: warning:", report)
+	}
+	if out == "-" {
+		_, err = stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(out, data, 0o644)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	resvg "github.com/kanrichan/resvg-go"
+)
+
+func TestRun(t *testing.T) {
+	svg, err := os.ReadFile("../../testdata/beach.svg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "beach.png")
+	var stderr bytes.Buffer
+	err = run(context.Background(), []string{"-w", "64", "../../testdata/beach.svg", out}, nil, io.Discard, &stderr)
+	if err != nil {
+		t.Fatal(err, stderr.String())
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 64, 64) {
+		t.Fatal("illegal png size", img.Bounds())
+	}
+	if _, _, _, a := img.At(32, 32).RGBA(); a == 0 {
+		t.Fatal("png must be rendered")
+	}
+	var stdout bytes.Buffer
+	err = run(context.Background(), []string{"-format", "jpeg", "-zoom", "0.125", "-", "-"}, bytes.NewReader(svg), &stdout, &stderr)
+	if err != nil {
+		t.Fatal(err, stderr.String())
+	}
+	img, err = jpeg.Decode(&stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 64, 64) {
+		t.Fatal("illegal jpeg size", img.Bounds())
+	}
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	err = os.MkdirAll(filepath.Join(src, "icons"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(src, "icons", "beach.svg"), svg, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	err = run(context.Background(), []string{"batch", "-w", "16", "-scales", "1,2", src, dst}, nil, &stdout, &stderr)
+	if err != nil {
+		t.Fatal(err, stderr.String(), stdout.String())
+	}
+	for _, name := range []string{"beach.png", "beach@2x.png"} {
+		_, err = os.Stat(filepath.Join(dst, "icons", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRunTextWarning(t *testing.T) {
+	svg := []byte(`<svg width="100" height="50" xmlns="http://www.w3.org/2000/svg">
+		<text x="10" y="30" font-family="Nothing">Hi</text>
+	</svg>`)
+	var stderr bytes.Buffer
+	err := run(context.Background(), []string{"-", "-"}, bytes.NewReader(svg), io.Discard, &stderr)
+	if err != nil {
+		t.Fatal(err, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), `warning: no font found for families ["Nothing"]`) {
+		t.Fatal("the text conversion report must be written to stderr, got", stderr.String())
+	}
+}
+
+func TestFit(t *testing.T) {
+	fset := flag.NewFlagSet("resvg-go", flag.ContinueOnError)
+	fset.SetOutput(io.Discard)
+	cfg := newConfig(fset)
+	cfg.outputFlags(fset)
+	for _, c := range []struct {
+		args          []string
+		scale         float32
+		width, height uint32
+	}{
+		{nil, 1, 200, 100},
+		{[]string{"-zoom", "2.5"}, 2.5, 500, 250},
+		{[]string{"-w", "100"}, 0.5, 100, 50},
+		{[]string{"-h", "300"}, 3, 600, 300},
+		{[]string{"-w", "100", "-h", "100"}, 0.5, 100, 50},
+	} {
+		*cfg = config{}
+		err := fset.Parse(c.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scale, width, height, err := cfg.fit(200, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if scale != c.scale || width != c.width || height != c.height {
+			t.Fatal(c.args, scale, width, height)
+		}
+	}
+	_, _, _, err := cfg.fit(0, 100)
+	if err == nil {
+		t.Fatal("fit no size")
+	}
+}
+
+func TestRenderingModes(t *testing.T) {
+	cfg := &config{shapeRendering: "optimizeSpeed", textRendering: "optimizeSpeed", imageRendering: "optimizeSpeed"}
+	opts, err := cfg.options("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.ShapeRenderingMode != resvg.ShapeRenderingModeOptimizeSpeed ||
+		opts.TextRenderingMode != resvg.TextRenderingModeOptimizeSpeed ||
+		opts.ImageRenderingMode != resvg.ImageRenderingModeOptimizeSpeed {
+		t.Fatal("optimizeSpeed must be set", opts)
+	}
+	opts, err = (&config{}).options("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.ShapeRenderingMode != resvg.ShapeRenderingModeDefault || opts.TextRenderingMode != resvg.TextRenderingModeDefault {
+		t.Fatal("unset modes must keep the defaults", opts)
+	}
+}
+
+func TestOutputFormat(t *testing.T) {
+	cfg := &config{}
+	for out, want := range map[string]string{"a.png": "png", "a.JPG": "jpeg", "a.jpeg": "jpeg", "-": "png"} {
+		format, err := cfg.outputFormat(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != want {
+			t.Fatal(out, format)
+		}
+	}
+	cfg.format = "gif"
+	_, err := cfg.outputFormat("a.gif")
+	if err == nil {
+		t.Fatal("gif")
+	}
+}
+
+func TestBatchSizes(t *testing.T) {
+	sizes, err := batchSizes("1, 2x,1.5", &config{width: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []resvg.BatchSize{
+		{Width: 64, Zoom: 1},
+		{Suffix: "@2x", Width: 64, Zoom: 2},
+		{Suffix: "@1.5x", Width: 64, Zoom: 1.5},
+	}
+	if len(sizes) != len(want) {
+		t.Fatal(sizes)
+	}
+	for i := range want {
+		if sizes[i] != want[i] {
+			t.Fatal(sizes[i])
+		}
+	}
+	_, err = batchSizes("0", &config{})
+	if err == nil {
+		t.Fatal("scale 0")
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	for name, poll := range map[string]time.Duration{"default": 0, "poll": 10 * time.Millisecond} {
+		dir := t.TempDir()
+		w, err := newWatcher(dir, poll)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// let the poller take its first scan
+		time.Sleep(20 * time.Millisecond)
+		path := filepath.Join(dir, "icons", "a.svg")
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte("<svg/>"), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case got := <-w.Events():
+			if got != path {
+				t.Fatal(name, "unexpected event", got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal(name, "no event of", path)
+		}
+		w.Close()
+	}
+}
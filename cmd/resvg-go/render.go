@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"os"
+
+	resvg "github.com/kanrichan/resvg-go"
+	_ "github.com/kanrichan/resvg-go/fonts"
+)
+
+// renderer renders SVGs with a warm worker and the fonts of the config.
+type renderer struct {
+	cfg    *config
+	wk     *resvg.Worker
+	fontdb *resvg.FontDB
+}
+
+// newRenderer starts a worker and loads the fonts, font warnings are written to stderr.
+func newRenderer(ctx context.Context, cfg *config, stderr io.Writer) (*renderer, error) {
+	wk, err := resvg.NewDefaultWorker(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r := &renderer{cfg: cfg, wk: wk}
+	r.fontdb, err = wk.NewFontDBDefault()
+	if err != nil {
+		wk.Close()
+		return nil, err
+	}
+	err = cfg.loadFonts(r.fontdb, stderr)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// loadFonts loads the fonts of the config into the fontdb, font warnings are written to stderr.
+func (cfg *config) loadFonts(fontdb *resvg.FontDB, stderr io.Writer) error {
+	if cfg.systemFonts {
+		err := fontdb.LoadSystemFonts()
+		if err != nil {
+			fmt.Fprintln(stderr, "resvg-go: warning:", err)
+		}
+	}
+	if cfg.bundledFonts {
+		err := fontdb.LoadBundled()
+		if err != nil {
+			return err
+		}
+	}
+	for _, file := range cfg.fontFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		err = fontdb.LoadFontData(data)
+		if err != nil {
+			return err
+		}
+	}
+	for _, dir := range cfg.fontDirs {
+		err := fontdb.LoadFontsFS(os.DirFS(dir), ".")
+		if err != nil {
+			fmt.Fprintln(stderr, "resvg-go: warning:", err)
+		}
+	}
+	for _, f := range []struct {
+		family string
+		set    func(string) error
+	}{
+		{cfg.serifFamily, fontdb.SetSerifFamily},
+		{cfg.sansSerifFamily, fontdb.SetSansSerifFamily},
+		{cfg.cursiveFamily, fontdb.SetCursiveFamily},
+		{cfg.fantasyFamily, fontdb.SetFantasyFamily},
+		{cfg.monospaceFamily, fontdb.SetMonospaceFamily},
+	} {
+		if f.family == "" {
+			continue
+		}
+		err := f.set(f.family)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the worker.
+func (r *renderer) Close() error {
+	r.fontdb.Close()
+	return r.wk.Close()
+}
+
+// render renders the SVG into an image of the format,
+// the report lists the fonts and glyphs the text conversion missed.
+func (r *renderer) render(svg []byte, resourcesDir string, format string) ([]byte, *resvg.TextConversionReport, error) {
+	opts, err := r.cfg.options(resourcesDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	tree, err := r.wk.NewTreeFromData(svg, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tree.Close()
+	report, err := tree.ConvertText(r.fontdb)
+	if err != nil {
+		return nil, nil, err
+	}
+	var x, y, w, h float32
+	if r.cfg.exportID != "" {
+		id := resvg.NodeID(r.cfg.exportID)
+		err = tree.RetainNode(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		bbox, err := tree.NodeBBox(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		x, y, w, h = bbox.X, bbox.Y, bbox.Width, bbox.Height
+	} else {
+		w, h, err = tree.GetSize()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	scale, width, height, err := r.cfg.fit(w, h)
+	if err != nil {
+		return nil, nil, err
+	}
+	pixmap, err := r.wk.NewPixmap(width, height)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer pixmap.Close()
+	background := r.cfg.background
+	if background == "" && format == "jpeg" {
+		background = "#ffffff"
+	}
+	if background != "" {
+		color, alpha, err := resvg.ParseColor(background)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = pixmap.Fill(color, alpha)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	err = tree.Render(resvg.TransformFromRow(scale, 0, 0, scale, -x*scale, -y*scale), pixmap)
+	if err != nil {
+		return nil, nil, err
+	}
+	if format == "png" {
+		data, err := pixmap.EncodePNG()
+		return data, report, err
+	}
+	img, err := pixmap.Image()
+	if err != nil {
+		return nil, nil, err
+	}
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: r.cfg.quality})
+	if err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), report, nil
+}
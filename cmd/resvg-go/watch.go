@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultPollInterval the interval of polling when inotify is unavailable.
+	defaultPollInterval = 500 * time.Millisecond
+	// watchDebounce waits for the burst of writes of an editor to settle.
+	watchDebounce = 50 * time.Millisecond
+)
+
+// runWatch renders the changed SVGs of a directory tree with a warm worker until interrupted.
+func runWatch(ctx context.Context, args []string, stderr io.Writer) error {
+	fset := flag.NewFlagSet("resvg-go watch", flag.ContinueOnError)
+	fset.SetOutput(stderr)
+	fset.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: resvg-go watch [flags] <src-dir> <dst-dir>")
+		fset.PrintDefaults()
+	}
+	cfg := newConfig(fset)
+	cfg.outputFlags(fset)
+	poll := fset.Duration("poll", 0, "poll for changes at the interval (default inotify on Linux, else 500ms)")
+	err := fset.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fset.NArg() != 2 {
+		fset.Usage()
+		return flag.ErrHelp
+	}
+	format, err := cfg.outputFormat("")
+	if err != nil {
+		return err
+	}
+	r, err := newRenderer(ctx, cfg, stderr)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	wr := &watchRenderer{r: r, src: fset.Arg(0), dst: fset.Arg(1), format: format, log: stderr}
+	w, err := newWatcher(wr.src, *poll)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	err = wr.renderOutdated()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stderr, "resvg-go: watching", wr.src)
+	pending := map[string]bool{}
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case path, ok := <-w.Events():
+			if !ok {
+				return nil
+			}
+			if isSVG(path) {
+				pending[path] = true
+				debounce = time.After(watchDebounce)
+			}
+		case <-debounce:
+			for path := range pending {
+				wr.render(path)
+			}
+			pending = map[string]bool{}
+			debounce = nil
+		}
+	}
+}
+
+// watchRenderer renders the SVGs of src into dst.
+type watchRenderer struct {
+	r      *renderer
+	src    string
+	dst    string
+	format string
+	log    io.Writer
+}
+
+// output returns the output path of an SVG.
+func (wr *watchRenderer) output(path string) (string, error) {
+	rel, err := filepath.Rel(wr.src, path)
+	if err != nil {
+		return "", err
+	}
+	ext := "png"
+	if wr.format == "jpeg" {
+		ext = "jpg"
+	}
+	return filepath.Join(wr.dst, strings.TrimSuffix(rel, filepath.Ext(rel))+"."+ext), nil
+}
+
+// renderOutdated renders the SVGs whose outputs are missing or older.
+func (wr *watchRenderer) renderOutdated() error {
+	return filepath.WalkDir(wr.src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isSVG(path) {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		output, err := wr.output(path)
+		if err != nil {
+			return err
+		}
+		out, err := os.Stat(output)
+		if err == nil && !out.ModTime().Before(info.ModTime()) {
+			return nil
+		}
+		wr.render(path)
+		return nil
+	})
+}
+
+// render renders an SVG and logs the result, errors don't stop the watch.
+func (wr *watchRenderer) render(path string) {
+	start := time.Now()
+	err := wr.renderFile(path)
+	if err != nil {
+		fmt.Fprintf(wr.log, "resvg-go: %s: %v\n", path, err)
+		return
+	}
+	fmt.Fprintf(wr.log, "resvg-go: rendered %s in %s\n", path, time.Since(start).Round(time.Microsecond))
+}
+
+func (wr *watchRenderer) renderFile(path string) error {
+	svg, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	resourcesDir := wr.r.cfg.resourcesDir
+	if resourcesDir == "" {
+		resourcesDir = filepath.Dir(path)
+	}
+	data, report, err := wr.r.render(svg, resourcesDir, wr.format)
+	if err != nil {
+		return err
+	}
+	if !report.Empty() {
+		fmt.Fprintf(wr.log, "resvg-go: %s: warning: %s\n", path, report)
+	}
+	output, err := wr.output(path)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(output), 0o755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(output, data, 0o644)
+}
+
+// isSVG reports whether the path is an SVG or SVGZ file.
+func isSVG(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".svg", ".svgz":
+		return true
+	}
+	return false
+}
+
+// watcher reports the paths of the files changed under a directory tree.
+type watcher interface {
+	Events() <-chan string
+	Close() error
+}
+
+// pollWatcher a watcher comparing the modification times and sizes at an interval.
+type pollWatcher struct {
+	dir    string
+	events chan string
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newPollWatcher(dir string, interval time.Duration) *pollWatcher {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	w := &pollWatcher{
+		dir:    dir,
+		events: make(chan string),
+		done:   make(chan struct{}),
+	}
+	seen := w.scan()
+	go func() {
+		defer close(w.events)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+			}
+			files := w.scan()
+			for path, stamp := range files {
+				if seen[path] == stamp {
+					continue
+				}
+				select {
+				case <-w.done:
+					return
+				case w.events <- path:
+				}
+			}
+			seen = files
+		}
+	}()
+	return w
+}
+
+// fileStamp the state of a file compared by polling.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func (w *pollWatcher) scan() map[string]fileStamp {
+	files := map[string]fileStamp{}
+	filepath.WalkDir(w.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files[path] = fileStamp{info.ModTime(), info.Size()}
+		return nil
+	})
+	return files
+}
+
+func (w *pollWatcher) Events() <-chan string {
+	return w.events
+}
+
+func (w *pollWatcher) Close() error {
+	w.once.Do(func() { close(w.done) })
+	return nil
+}
@@ -0,0 +1,136 @@
+//go:build linux
+
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// newWatcher returns an inotify watcher, or a polling watcher when poll is set.
+func newWatcher(dir string, poll time.Duration) (watcher, error) {
+	if poll > 0 {
+		return newPollWatcher(dir, poll), nil
+	}
+	return newInotifyWatcher(dir)
+}
+
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE
+
+// inotifyWatcher a watcher of the inotify events of every directory of the tree.
+type inotifyWatcher struct {
+	fd     int
+	file   *os.File
+	events chan string
+	done   chan struct{}
+	// dirs the directories of the watch descriptors, only used by the reading goroutine.
+	dirs map[int32]string
+	once sync.Once
+}
+
+func newInotifyWatcher(dir string) (*inotifyWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	// non-blocking, so that the reading is interrupted by `Close`
+	w := &inotifyWatcher{
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		events: make(chan string),
+		done:   make(chan struct{}),
+		dirs:   map[int32]string{},
+	}
+	_, err = w.addTree(dir)
+	if err != nil {
+		w.file.Close()
+		return nil, err
+	}
+	go w.read()
+	return w, nil
+}
+
+// addTree watches the directories of the tree and returns the files in it.
+func (w *inotifyWatcher) addTree(root string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			files = append(files, path)
+			return nil
+		}
+		wd, err := syscall.InotifyAddWatch(w.fd, path, inotifyMask)
+		if err != nil {
+			return os.NewSyscallError("inotify_add_watch", err)
+		}
+		w.dirs[int32(wd)] = path
+		return nil
+	})
+	return files, err
+}
+
+func (w *inotifyWatcher) read() {
+	defer close(w.events)
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			name := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(event.Len)]
+			off += syscall.SizeofInotifyEvent + int(event.Len)
+			dir, ok := w.dirs[event.Wd]
+			if !ok || len(name) == 0 {
+				continue
+			}
+			path := filepath.Join(dir, strings.TrimRight(string(name), "\x00"))
+			switch {
+			case event.Mask&syscall.IN_ISDIR != 0:
+				// a new directory may be filled before its watch is added
+				files, _ := w.addTree(path)
+				for _, file := range files {
+					if !w.send(file) {
+						return
+					}
+				}
+			case event.Mask&(syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO) != 0:
+				if !w.send(path) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// send reports false when the watcher is closed.
+func (w *inotifyWatcher) send(path string) bool {
+	select {
+	case <-w.done:
+		return false
+	case w.events <- path:
+		return true
+	}
+}
+
+func (w *inotifyWatcher) Events() <-chan string {
+	return w.events
+}
+
+func (w *inotifyWatcher) Close() error {
+	var err error
+	w.once.Do(func() {
+		close(w.done)
+		err = w.file.Close()
+	})
+	return err
+}
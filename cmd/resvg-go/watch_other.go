@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "time"
+
+// newWatcher returns a polling watcher, inotify is only available on Linux.
+func newWatcher(dir string, poll time.Duration) (watcher, error) {
+	return newPollWatcher(dir, poll), nil
+}
@@ -1,148 +1,803 @@
 package resvg
 
-import "github.com/kanrichan/resvg-go/internal"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/kanrichan/resvg-go/internal"
+)
+
+// ErrNoFaces returned when a font file contains no usable face.
+var ErrNoFaces = errors.New("no font faces found")
+
+// FontLoadError a font file that couldn't be loaded.
+type FontLoadError struct {
+	Path string
+	Err  error
+}
+
+func (e *FontLoadError) Error() string {
+	return "load font " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *FontLoadError) Unwrap() error {
+	return e.Err
+}
+
+// FaceID an opaque ID of a face in the `FontDB`.
+type FaceID string
+
+// Style a font style.
+type Style int32
+
+// Weight a font weight, `font-weight` in CSS.
+type Weight uint16
+
+// Stretch a font stretch, `font-stretch` in CSS.
+type Stretch int32
+
+const (
+	// StyleNormal Normal
+	StyleNormal Style = iota
+	// StyleItalic Italic
+	StyleItalic
+	// StyleOblique Oblique
+	StyleOblique
+)
+
+const (
+	// WeightThin 100
+	WeightThin Weight = 100
+	// WeightExtraLight 200
+	WeightExtraLight Weight = 200
+	// WeightLight 300
+	WeightLight Weight = 300
+	// WeightNormal 400
+	WeightNormal Weight = 400
+	// WeightMedium 500
+	WeightMedium Weight = 500
+	// WeightSemibold 600
+	WeightSemibold Weight = 600
+	// WeightBold 700
+	WeightBold Weight = 700
+	// WeightExtraBold 800
+	WeightExtraBold Weight = 800
+	// WeightBlack 900
+	WeightBlack Weight = 900
+)
+
+const (
+	// StretchUltraCondensed UltraCondensed
+	StretchUltraCondensed Stretch = iota + 1
+	// StretchExtraCondensed ExtraCondensed
+	StretchExtraCondensed
+	// StretchCondensed Condensed
+	StretchCondensed
+	// StretchSemiCondensed SemiCondensed
+	StretchSemiCondensed
+	// StretchNormal Normal
+	StretchNormal
+	// StretchSemiExpanded SemiExpanded
+	StretchSemiExpanded
+	// StretchExpanded Expanded
+	StretchExpanded
+	// StretchExtraExpanded ExtraExpanded
+	StretchExtraExpanded
+	// StretchUltraExpanded UltraExpanded
+	StretchUltraExpanded
+)
+
+// FamilyName a family name of a face in a language.
+type FamilyName struct {
+	Name string `json:"name"`
+	// Language the name table language, like `English_UnitedStates`.
+	Language string `json:"language"`
+}
+
+// FaceSource where a face was loaded from.
+type FaceSource struct {
+	// Path the font file, empty for fonts loaded from data.
+	Path string `json:"path"`
+	// Blob identifies the in-memory font data, shared by the faces
+	// of one `LoadFontData` call and never reused by another,
+	// zero for fonts loaded from files.
+	Blob uint32 `json:"blob"`
+}
+
+// FaceInfo a face in the `FontDB`.
+type FaceInfo struct {
+	ID             FaceID       `json:"id"`
+	Families       []FamilyName `json:"families"`
+	PostScriptName string       `json:"post_script_name"`
+	Style          Style        `json:"style"`
+	Weight         Weight       `json:"weight"`
+	Stretch        Stretch      `json:"stretch"`
+	Monospaced     bool         `json:"monospaced"`
+	Source         FaceSource   `json:"source"`
+	// Index the face index in a font collection.
+	Index uint32 `json:"index"`
+}
+
+// Query a CSS-like font query.
+type Query struct {
+	// Families the prioritized list of font families, like `font-family` in CSS.
+	// Generic families `serif`, `sans-serif`, `cursive`, `fantasy` and
+	// `monospace` resolve to the families set by the `Set*Family` methods.
+	Families []string
+	// Weight default: WeightNormal
+	Weight Weight
+	// Style default: StyleNormal
+	Style Style
+	// Stretch default: StretchNormal
+	Stretch Stretch
+}
 
 // FontDB font database
 type FontDB struct {
 	wk  *Worker
 	ptr int32
+	// synced what each `FontRegistry` has replicated into the `FontDB`.
+	synced map[*FontRegistry]registrySync
+	// fallbacks the fallback families by script, see `SetFallbackFamilies`.
+	fallbacks map[string][]string
+	// size the bytes of the font data loaded.
+	size int64
+	// fingerprint folds every change of the fonts, see `Fingerprint`.
+	fingerprint [sha256.Size]byte
 }
 
 // NewFontDBDefault new a empty `FontDB` object in wasm.
 // `FontDB` are not goroutine-safe, don't forget to close!
 func (wk *Worker) NewFontDBDefault() (*FontDB, error) {
-	if !wk.used.CompareAndSwap(false, true) {
-		return nil, ErrWorkerIsBeingUsed
+	if err := wk.acquire(); err != nil {
+		return nil, err
 	}
-	defer wk.used.Store(false)
+	defer wk.release()
 	db, err := internal.FontdbDatabaseDefault(wk.ctx, wk.mod)
 	if err != nil {
 		return nil, err
 	}
-	return &FontDB{wk, db}, nil
+	fontdb := &FontDB{wk: wk, ptr: db}
+	wk.track(handleFontDB, 0)
+	runtime.SetFinalizer(fontdb, (*FontDB).finalize)
+	return fontdb, nil
 }
 
 // Close cloes the `FontDB` and recovers memory.
 func (db *FontDB) Close() error {
-	if !db.wk.used.CompareAndSwap(false, true) {
-		return ErrWorkerIsBeingUsed
+	if err := db.wk.acquire(); err != nil {
+		return err
 	}
-	defer db.wk.used.Store(false)
+	defer db.wk.release()
 	if db.ptr == 0 {
-		return ErrPointerIsNil
+		return ErrClosed
 	}
 	err := internal.FontdbDatabaseDelete(db.wk.ctx, db.wk.mod, db.ptr)
 	if err != nil {
 		return err
 	}
 	db.ptr = 0
+	db.wk.untrack(handleFontDB, db.size)
+	runtime.SetFinalizer(db, nil)
 	return nil
 }
 
+// finalize queues the wasm memory of a `FontDB` that was not closed to be freed.
+func (db *FontDB) finalize() {
+	db.wk.finalize(handleFontDB, db.ptr, db.size)
+}
+
 // LoadFontFile loads font file into the `FontDB`.
 func (db *FontDB) LoadFontFile(file string) error {
-	if !db.wk.used.CompareAndSwap(false, true) {
-		return ErrWorkerIsBeingUsed
+	_, err := db.loadFontFile(file, file)
+	return err
+}
+
+// loadFontFile loads the font file of the path in the wasm module, which is
+// the file of the host, into the `FontDB` and returns the number of faces it added.
+func (db *FontDB) loadFontFile(file string, host string) (int32, error) {
+	if err := db.wk.acquire(); err != nil {
+		return 0, err
 	}
-	defer db.wk.used.Store(false)
+	defer db.wk.release()
 	if db.ptr == 0 {
-		return ErrPointerIsNil
+		return 0, ErrClosed
 	}
-	return internal.FontdbDatabaseLoadFontFile(db.wk.ctx, db.wk.mod, db.ptr, file)
+	before, err := internal.FontdbDatabaseLen(db.wk.ctx, db.wk.mod, db.ptr)
+	if err != nil {
+		return 0, err
+	}
+	err = internal.FontdbDatabaseLoadFontFile(db.wk.ctx, db.wk.mod, db.ptr, file)
+	if err != nil {
+		return 0, err
+	}
+	after, err := internal.FontdbDatabaseLen(db.wk.ctx, db.wk.mod, db.ptr)
+	if err != nil {
+		return 0, err
+	}
+	if info, err := os.Stat(host); err == nil {
+		db.grow(info.Size())
+		db.mix("file", file, fileStamp(info))
+	} else {
+		db.mix("file", file)
+	}
+	return after - before, nil
 }
 
 // LoadFontsDir loads font files from the selected directory into the `FontDB`.
 func (db *FontDB) LoadFontsDir(dir string) error {
-	if !db.wk.used.CompareAndSwap(false, true) {
-		return ErrWorkerIsBeingUsed
+	if err := db.wk.acquire(); err != nil {
+		return err
 	}
-	defer db.wk.used.Store(false)
+	defer db.wk.release()
 	if db.ptr == 0 {
-		return ErrPointerIsNil
+		return ErrClosed
 	}
-	return internal.FontdbDatabaseLoadFontsDir(db.wk.ctx, db.wk.mod, db.ptr, dir)
+	err := internal.FontdbDatabaseLoadFontsDir(db.wk.ctx, db.wk.mod, db.ptr, dir)
+	if err != nil {
+		return err
+	}
+	size, stamp := fontFiles(dir)
+	db.grow(size)
+	db.mix("dir", dir, stamp)
+	return nil
 }
 
 // LoadFontData loads font data into the `FontDB`.
 func (db *FontDB) LoadFontData(data []byte) error {
-	if !db.wk.used.CompareAndSwap(false, true) {
-		return ErrWorkerIsBeingUsed
+	_, err := db.loadFontData(data)
+	return err
+}
+
+// loadFontData loads font data and returns the number of faces added.
+func (db *FontDB) loadFontData(data []byte) (int32, error) {
+	if err := db.wk.acquire(); err != nil {
+		return 0, err
 	}
-	defer db.wk.used.Store(false)
+	defer db.wk.release()
 	if db.ptr == 0 {
-		return ErrPointerIsNil
+		return 0, ErrClosed
+	}
+	// the faces are counted by the length, which keeps the ABI of the export
+	before, err := internal.FontdbDatabaseLen(db.wk.ctx, db.wk.mod, db.ptr)
+	if err != nil {
+		return 0, err
+	}
+	err = internal.FontdbDatabaseLoadFontData(db.wk.ctx, db.wk.mod, db.ptr, data)
+	if err != nil {
+		return 0, err
 	}
-	return internal.FontdbDatabaseLoadFontData(db.wk.ctx, db.wk.mod, db.ptr, data)
+	after, err := internal.FontdbDatabaseLen(db.wk.ctx, db.wk.mod, db.ptr)
+	if err != nil {
+		return 0, err
+	}
+	db.grow(int64(len(data)))
+	sum := sha256.Sum256(data)
+	db.mix("data", string(sum[:]))
+	return after - before, nil
+}
+
+// grow counts size bytes of font data loaded into the `FontDB`.
+func (db *FontDB) grow(size int64) {
+	db.size += size
+	db.wk.stats.fontBytes.Add(size)
+}
+
+// Fingerprint returns a hash of the fonts, families and fallbacks of the `FontDB`,
+// such as to key the rendered images in a cache.
+// It changes with every change of the `FontDB`, and `FontDB`s changed the same way
+// have the same fingerprint. Loaded files are told apart by their path, size and
+// modification time, loaded data by its content.
+func (db *FontDB) Fingerprint() string {
+	return hex.EncodeToString(db.fingerprint[:])
+}
+
+// mix folds a change of the `FontDB` into its fingerprint.
+func (db *FontDB) mix(change ...string) {
+	h := sha256.New()
+	h.Write(db.fingerprint[:])
+	for _, s := range change {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	h.Sum(db.fingerprint[:0])
+}
+
+// fileStamp identifies the version of a file by its size and modification time.
+func fileStamp(info fs.FileInfo) string {
+	return strconv.FormatInt(info.Size(), 10) + "@" + strconv.FormatInt(info.ModTime().UnixNano(), 10)
+}
+
+// fontFiles returns the size and the stamps of the font files in the dir recursively.
+func fontFiles(dir string) (int64, string) {
+	var size int64
+	var stamp strings.Builder
+	filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if !isFontFile(name) {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+			stamp.WriteString(name + "=" + fileStamp(info) + "\n")
+		}
+		return nil
+	})
+	return size, stamp.String()
+}
+
+// LoadFontsFS loads font files (ttf, otf, ttc and otc) from the root directory
+// of the fsys recursively into the `FontDB`, such as an `embed.FS`.
+// Unlike `LoadFontsDir`, files that can't be read or contain no face are
+// reported as `*FontLoadError`s joined together, the other files are loaded.
+func (db *FontDB) LoadFontsFS(fsys fs.FS, root string) error {
+	errs, err := db.loadFontsFS(fsys, root, "")
+	if err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+// LoadSystemFonts loads the fonts of the standard font directories of the host
+// into the `FontDB` by their paths, so the faces keep their `FaceSource.Path`.
+// The directories are searched like fontconfig does, `fonts` in `$XDG_DATA_HOME`
+// (`~/.local/share`) and `$XDG_DATA_DIRS` (`/usr/local/share:/usr/share`),
+// and `~/.fonts`, following symbolic links. They are mounted read-only into
+// the wasm module at their slash-separated paths when the `Worker` is created,
+// directories created later are skipped. The errors are reported as in `LoadFontsFS`.
+func (db *FontDB) LoadSystemFonts() error {
+	var errs []error
+	seen := make(map[string]bool)
+	for _, m := range db.wk.fontDirs {
+		e, err := db.loadSystemFontsDir(m.dir, m.guest, seen)
+		if err != nil {
+			return err
+		}
+		errs = append(errs, e...)
+	}
+	return errors.Join(errs...)
+}
+
+// loadSystemFontsDir loads font files from the dir recursively, following
+// symbolic links, as the files of the guest directory in the wasm module.
+// The directories in seen are skipped.
+func (db *FontDB) loadSystemFontsDir(dir string, guest string, seen map[string]bool) ([]error, error) {
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return []error{&FontLoadError{dir, err}}, nil
+	}
+	if seen[real] {
+		return nil, nil
+	}
+	seen[real] = true
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return []error{&FontLoadError{dir, err}}, nil
+	}
+	var errs []error
+	for _, entry := range entries {
+		name := filepath.Join(dir, entry.Name())
+		file := path.Join(guest, entry.Name())
+		info, err := os.Stat(name) // follows symbolic links
+		if err != nil {
+			errs = append(errs, &FontLoadError{name, err})
+			continue
+		}
+		if info.IsDir() {
+			e, err := db.loadSystemFontsDir(name, file, seen)
+			if err != nil {
+				return nil, err
+			}
+			errs = append(errs, e...)
+			continue
+		}
+		if !isFontFile(name) {
+			continue
+		}
+		n, err := db.loadFontFile(file, name)
+		if stopLoading(err) {
+			return nil, err
+		}
+		if err == nil && n == 0 {
+			err = ErrNoFaces
+		}
+		if err != nil {
+			errs = append(errs, &FontLoadError{name, err})
+		}
+	}
+	return errs, nil
+}
+
+// isFontFile reports whether the name has a font file extension.
+func isFontFile(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".ttf", ".otf", ".ttc", ".otc":
+		return true
+	}
+	return false
+}
+
+// stopLoading reports whether err is a matter of the `FontDB` rather than
+// of a font file.
+func stopLoading(err error) bool {
+	return errors.Is(err, ErrClosed) || errors.Is(err, ErrWorkerClosed) || errors.Is(err, ErrWorkerIsBeingUsed)
+}
+
+// fontMount a host directory mounted into the wasm module at the guest path.
+type fontMount struct {
+	dir   string
+	guest string
+}
+
+// systemFontMounts returns the existing system font directories
+// and the paths to mount them at.
+func systemFontMounts() []fontMount {
+	var mounts []fontMount
+	for _, dir := range systemFontDirs() {
+		if !filepath.IsAbs(dir) {
+			continue
+		}
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		// such as /usr/share/fonts, or /C:/Windows/Fonts on Windows
+		guest := path.Join("/", filepath.ToSlash(dir))
+		mounts = append(mounts, fontMount{dir, guest})
+	}
+	return mounts
+}
+
+// systemFontDirs returns the standard font directories of the host.
+func systemFontDirs() []string {
+	home, _ := os.UserHomeDir()
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" && home != "" {
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	dataDirs := os.Getenv("XDG_DATA_DIRS")
+	if dataDirs == "" {
+		dataDirs = "/usr/local/share:/usr/share"
+	}
+	var dirs []string
+	if dataHome != "" {
+		dirs = append(dirs, filepath.Join(dataHome, "fonts"))
+	}
+	if home != "" {
+		dirs = append(dirs, filepath.Join(home, ".fonts"))
+	}
+	for _, dir := range filepath.SplitList(dataDirs) {
+		if dir != "" {
+			dirs = append(dirs, filepath.Join(dir, "fonts"))
+		}
+	}
+	seen := make(map[string]bool)
+	unique := dirs[:0]
+	for _, dir := range dirs {
+		if !seen[dir] {
+			seen[dir] = true
+			unique = append(unique, dir)
+		}
+	}
+	return unique
+}
+
+// loadFontsFS loads font files from the fsys, the paths of the returned
+// `*FontLoadError`s are joined to dir.
+func (db *FontDB) loadFontsFS(fsys fs.FS, root, dir string) ([]error, error) {
+	var errs []error
+	err := fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			errs = append(errs, &FontLoadError{filepath.Join(dir, name), err})
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if !isFontFile(name) {
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			errs = append(errs, &FontLoadError{filepath.Join(dir, name), err})
+			return nil
+		}
+		n, err := db.loadFontData(data)
+		if stopLoading(err) {
+			return err
+		}
+		if err == nil && n == 0 {
+			err = ErrNoFaces
+		}
+		if err != nil {
+			errs = append(errs, &FontLoadError{filepath.Join(dir, name), err})
+		}
+		return nil
+	})
+	return errs, err
 }
 
 // SetSerifFamily sets the family that will be used by `Family::Serif`.
 func (db *FontDB) SetSerifFamily(family string) error {
-	if !db.wk.used.CompareAndSwap(false, true) {
-		return ErrWorkerIsBeingUsed
+	if err := db.wk.acquire(); err != nil {
+		return err
 	}
-	defer db.wk.used.Store(false)
+	defer db.wk.release()
 	if db.ptr == 0 {
-		return ErrPointerIsNil
+		return ErrClosed
+	}
+	err := internal.FontdbDatabaseSetSerifFamily(db.wk.ctx, db.wk.mod, db.ptr, family)
+	if err != nil {
+		return err
 	}
-	return internal.FontdbDatabaseSetSerifFamily(db.wk.ctx, db.wk.mod, db.ptr, family)
+	db.mix("family", "serif", family)
+	return nil
 }
 
 // SetSansSerifFamily sets the family that will be used by `Family::SansSerif`.
 func (db *FontDB) SetSansSerifFamily(family string) error {
-	if !db.wk.used.CompareAndSwap(false, true) {
-		return ErrWorkerIsBeingUsed
+	if err := db.wk.acquire(); err != nil {
+		return err
 	}
-	defer db.wk.used.Store(false)
+	defer db.wk.release()
 	if db.ptr == 0 {
-		return ErrPointerIsNil
+		return ErrClosed
 	}
-	return internal.FontdbDatabaseSetSansSerifFamily(db.wk.ctx, db.wk.mod, db.ptr, family)
+	err := internal.FontdbDatabaseSetSansSerifFamily(db.wk.ctx, db.wk.mod, db.ptr, family)
+	if err != nil {
+		return err
+	}
+	db.mix("family", "sans-serif", family)
+	return nil
 }
 
 // SetCursiveFamily sets the family that will be used by `Family::Cursive`.
 func (db *FontDB) SetCursiveFamily(family string) error {
-	if !db.wk.used.CompareAndSwap(false, true) {
-		return ErrWorkerIsBeingUsed
+	if err := db.wk.acquire(); err != nil {
+		return err
 	}
-	defer db.wk.used.Store(false)
+	defer db.wk.release()
 	if db.ptr == 0 {
-		return ErrPointerIsNil
+		return ErrClosed
+	}
+	err := internal.FontdbDatabaseSetCursiveFamily(db.wk.ctx, db.wk.mod, db.ptr, family)
+	if err != nil {
+		return err
 	}
-	return internal.FontdbDatabaseSetCursiveFamily(db.wk.ctx, db.wk.mod, db.ptr, family)
+	db.mix("family", "cursive", family)
+	return nil
 }
 
 // SetFantasyFamily sets the family that will be used by `Family::Fantasy`.
 func (db *FontDB) SetFantasyFamily(family string) error {
-	if !db.wk.used.CompareAndSwap(false, true) {
-		return ErrWorkerIsBeingUsed
+	if err := db.wk.acquire(); err != nil {
+		return err
 	}
-	defer db.wk.used.Store(false)
+	defer db.wk.release()
 	if db.ptr == 0 {
-		return ErrPointerIsNil
+		return ErrClosed
 	}
-	return internal.FontdbDatabaseSetFantasyFamily(db.wk.ctx, db.wk.mod, db.ptr, family)
+	err := internal.FontdbDatabaseSetFantasyFamily(db.wk.ctx, db.wk.mod, db.ptr, family)
+	if err != nil {
+		return err
+	}
+	db.mix("family", "fantasy", family)
+	return nil
 }
 
 // SetMonospaceFamily sets the family that will be used by `Family::Monospace`.
 func (db *FontDB) SetMonospaceFamily(family string) error {
-	if !db.wk.used.CompareAndSwap(false, true) {
-		return ErrWorkerIsBeingUsed
+	if err := db.wk.acquire(); err != nil {
+		return err
+	}
+	defer db.wk.release()
+	if db.ptr == 0 {
+		return ErrClosed
+	}
+	err := internal.FontdbDatabaseSetMonospaceFamily(db.wk.ctx, db.wk.mod, db.ptr, family)
+	if err != nil {
+		return err
+	}
+	db.mix("family", "monospace", family)
+	return nil
+}
+
+// SetFallbackFamilies sets the families consulted in order by `Tree.ConvertText`
+// for the characters of the script missing from the primary face of a text.
+// The script is an ISO 15924 code, such as "Latn", "Hani", "Hang" or "Arab",
+// or "*" for the characters of any script, which is consulted after the script ones.
+// Emoji, digits and punctuation are of the "Zyyy" (common) script.
+// Empty families remove the fallback of the script.
+func (db *FontDB) SetFallbackFamilies(script string, families []string) error {
+	if err := db.wk.acquire(); err != nil {
+		return err
 	}
-	defer db.wk.used.Store(false)
+	defer db.wk.release()
 	if db.ptr == 0 {
-		return ErrPointerIsNil
+		return ErrClosed
+	}
+	db.mix(append([]string{"fallback", script}, families...)...)
+	if len(families) == 0 {
+		delete(db.fallbacks, script)
+		return nil
 	}
-	return internal.FontdbDatabaseSetMonospaceFamily(db.wk.ctx, db.wk.mod, db.ptr, family)
+	if db.fallbacks == nil {
+		db.fallbacks = make(map[string][]string)
+	}
+	db.fallbacks[script] = append([]string(nil), families...)
+	return nil
 }
 
 // Len returns the number of font faces in the `FontDB`
 func (db *FontDB) Len() (int32, error) {
-	if !db.wk.used.CompareAndSwap(false, true) {
-		return 0, ErrWorkerIsBeingUsed
+	if err := db.wk.acquire(); err != nil {
+		return 0, err
 	}
-	defer db.wk.used.Store(false)
+	defer db.wk.release()
 	if db.ptr == 0 {
-		return 0, ErrPointerIsNil
+		return 0, ErrClosed
 	}
 	return internal.FontdbDatabaseLen(db.wk.ctx, db.wk.mod, db.ptr)
 }
+
+// Faces returns the font faces in the `FontDB`.
+func (db *FontDB) Faces() ([]FaceInfo, error) {
+	if err := db.wk.acquire(); err != nil {
+		return nil, err
+	}
+	defer db.wk.release()
+	if db.ptr == 0 {
+		return nil, ErrClosed
+	}
+	data, err := internal.FontdbDatabaseFaces(db.wk.ctx, db.wk.mod, db.ptr)
+	if err != nil {
+		return nil, err
+	}
+	var faces []FaceInfo
+	err = json.Unmarshal(data, &faces)
+	if err != nil {
+		return nil, err
+	}
+	return faces, nil
+}
+
+// Query returns the face that best matches the query,
+// the same way a `font-family` is resolved when converting text.
+func (db *FontDB) Query(query Query) (FaceInfo, bool, error) {
+	if err := db.wk.acquire(); err != nil {
+		return FaceInfo{}, false, err
+	}
+	defer db.wk.release()
+	if db.ptr == 0 {
+		return FaceInfo{}, false, ErrClosed
+	}
+	families, err := json.Marshal(query.Families)
+	if err != nil {
+		return FaceInfo{}, false, err
+	}
+	weight := query.Weight
+	if weight == 0 {
+		weight = WeightNormal
+	}
+	data, err := internal.FontdbDatabaseQuery(db.wk.ctx, db.wk.mod, db.ptr, string(families), uint16(weight), int32(query.Style), int32(query.Stretch))
+	if err != nil {
+		return FaceInfo{}, false, err
+	}
+	var face *FaceInfo
+	err = json.Unmarshal(data, &face)
+	if err != nil {
+		return FaceInfo{}, false, err
+	}
+	if face == nil {
+		return FaceInfo{}, false, nil
+	}
+	return *face, true, nil
+}
+
+// RemoveFace removes the face from the `FontDB`.
+// A face of a `FontRegistry` is not loaded again by its `Sync`.
+func (db *FontDB) RemoveFace(id FaceID) error {
+	if err := db.wk.acquire(); err != nil {
+		return err
+	}
+	defer db.wk.release()
+	if db.ptr == 0 {
+		return ErrClosed
+	}
+	err := internal.FontdbDatabaseRemoveFace(db.wk.ctx, db.wk.mod, db.ptr, string(id))
+	if err != nil {
+		return err
+	}
+	db.mix("remove", string(id))
+	return nil
+}
+
+// RemoveBySource removes all faces loaded from the source,
+// a font file or the data of one `LoadFontData` call,
+// and returns the number of removed faces.
+// The faces of a `FontRegistry` are not loaded again by its `Sync`.
+func (db *FontDB) RemoveBySource(source FaceSource) (int32, error) {
+	if err := db.wk.acquire(); err != nil {
+		return 0, err
+	}
+	defer db.wk.release()
+	if db.ptr == 0 {
+		return 0, ErrClosed
+	}
+	n, err := internal.FontdbDatabaseRemoveBySource(db.wk.ctx, db.wk.mod, db.ptr, source.Path, source.Blob)
+	if err != nil {
+		return 0, err
+	}
+	db.mix("remove", source.Path, strconv.FormatUint(uint64(source.Blob), 10))
+	return n, nil
+}
+
+// Clear removes all faces from the `FontDB`, generic families are kept.
+// The fonts of the `FontRegistry`s are loaded again by their next `Sync`.
+func (db *FontDB) Clear() error {
+	if err := db.wk.acquire(); err != nil {
+		return err
+	}
+	defer db.wk.release()
+	if db.ptr == 0 {
+		return ErrClosed
+	}
+	err := internal.FontdbDatabaseClear(db.wk.ctx, db.wk.mod, db.ptr)
+	if err != nil {
+		return err
+	}
+	db.grow(-db.size)
+	db.mix("clear")
+	for r, state := range db.synced {
+		state.fonts = 0
+		db.synced[r] = state
+	}
+	return nil
+}
+
+// SerifFamily returns the family that will be used by `Family::Serif`.
+func (db *FontDB) SerifFamily() (string, error) {
+	return db.familyName(0)
+}
+
+// SansSerifFamily returns the family that will be used by `Family::SansSerif`.
+func (db *FontDB) SansSerifFamily() (string, error) {
+	return db.familyName(1)
+}
+
+// CursiveFamily returns the family that will be used by `Family::Cursive`.
+func (db *FontDB) CursiveFamily() (string, error) {
+	return db.familyName(2)
+}
+
+// FantasyFamily returns the family that will be used by `Family::Fantasy`.
+func (db *FontDB) FantasyFamily() (string, error) {
+	return db.familyName(3)
+}
+
+// MonospaceFamily returns the family that will be used by `Family::Monospace`.
+func (db *FontDB) MonospaceFamily() (string, error) {
+	return db.familyName(4)
+}
+
+func (db *FontDB) familyName(generic int32) (string, error) {
+	if err := db.wk.acquire(); err != nil {
+		return "", err
+	}
+	defer db.wk.release()
+	if db.ptr == 0 {
+		return "", ErrClosed
+	}
+	return internal.FontdbDatabaseFamilyName(db.wk.ctx, db.wk.mod, db.ptr, generic)
+}
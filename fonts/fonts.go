@@ -0,0 +1,44 @@
+// Package fonts bundles a small set of open-licensed fonts for resvg,
+// so that `<text>` can be rendered without system fonts.
+//
+// Import it for its side effect and call `FontDB.LoadBundled`:
+//
+//	import _ "github.com/kanrichan/resvg-go/fonts"
+//
+// The fonts are licensed under the SIL Open Font License, see the license files.
+package fonts
+
+import (
+	"embed"
+
+	resvg "github.com/kanrichan/resvg-go"
+)
+
+// FS the bundled font files and their licenses.
+//
+//go:embed *.ttf *LICENSE*
+var FS embed.FS
+
+// Families the generic families set by `FontDB.LoadBundled`.
+var Families = resvg.GenericFamilies{
+	Serif:     "Source Serif 4",
+	SansSerif: "Fira Sans",
+	Cursive:   "Fira Sans",
+	Fantasy:   "Fira Sans",
+	Monospace: "Fira Mono",
+}
+
+// Fallbacks the fallback families by script set by `FontDB.LoadBundled`.
+// The bundled fonts only cover Latin, Greek, Cyrillic and Hangul,
+// there is no broad-coverage fallback: Han, kana, Arabic, Indic scripts
+// and emoji need fonts of their own, see `FontDB.SetFallbackFamilies`.
+var Fallbacks = map[string][]string{
+	"Hang": {"NanumBarunGothic"},
+}
+
+func init() {
+	err := resvg.RegisterBundledFonts(FS, Families, Fallbacks)
+	if err != nil {
+		panic(err)
+	}
+}
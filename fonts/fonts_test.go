@@ -0,0 +1,63 @@
+package fonts
+
+import (
+	"context"
+	"testing"
+
+	resvg "github.com/kanrichan/resvg-go"
+)
+
+func TestLoadBundled(t *testing.T) {
+	worker, err := resvg.NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	fontdb, err := worker.NewFontDBDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fontdb.Close()
+	err = fontdb.LoadBundled()
+	if err != nil {
+		t.Fatal(err)
+	}
+	num, err := fontdb.Len()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if num != 4 {
+		t.Fatal("fontdb len must be 4")
+	}
+	family, err := fontdb.MonospaceFamily()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if family != Families.Monospace {
+		t.Fatal("monospace family must be " + Families.Monospace)
+	}
+	for script, families := range Fallbacks {
+		_, ok, err := fontdb.Query(resvg.Query{Families: families})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatal("fallback families of " + script + " not found")
+		}
+	}
+	tree, err := worker.NewTreeFromData([]byte(
+		`<svg width="100" height="50" xmlns="http://www.w3.org/2000/svg">
+			<text x="10" y="30" font-family="Fira Sans">Hi 한</text>
+		</svg>`), &resvg.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	report, err := tree.ConvertText(fontdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Empty() {
+		t.Fatal("Hangul must be drawn with the fallback family, got", report)
+	}
+}
@@ -0,0 +1,310 @@
+// Package httprender serves SVGs rendered to PNG or JPEG over HTTP.
+//
+// A POST renders the SVG of the body, a GET renders the SVG of the path in an `fs.FS`.
+// The query takes `width`, `height`, `zoom`, `format` (png or jpeg) and `background` (such as #fff).
+// Workers with a `resvg.TreeCache` skip parsing the SVGs rendered again at other sizes.
+//
+//	fonts := resvg.NewFontRegistry()
+//	fonts.AddFontsFS(os.DirFS("fonts"), ".")
+//	pool, _ := resvg.NewPool(ctx, resvg.PoolOptions{
+//		Fonts:         fonts,
+//		WorkerOptions: []resvg.WorkerOption{resvg.WithTreeCache(16)},
+//	})
+//	http.Handle("/icons/", http.StripPrefix("/icons/", httprender.NewHandler(pool, httprender.HandlerOptions{
+//		FS: os.DirFS("icons"),
+//	})))
+package httprender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	resvg "github.com/kanrichan/resvg-go"
+	"github.com/kanrichan/resvg-go/rendercache"
+)
+
+const (
+	// DefaultMaxBodySize the default limit of the SVG size.
+	DefaultMaxBodySize = 10 << 20
+	// DefaultMaxPixels the default limit of the pixels of an image, 64 MiB of RGBA.
+	DefaultMaxPixels = 4096 * 4096
+	// DefaultTimeout the default time limit of a request.
+	DefaultTimeout = 10 * time.Second
+	// DefaultCacheControl the default `Cache-Control` of the images.
+	DefaultCacheControl = "public, max-age=3600"
+)
+
+// HandlerOptions the options of a `Handler`.
+type HandlerOptions struct {
+	// FS serves the SVGs of the GET requests by path.
+	// Default: nil, only POST is allowed.
+	FS fs.FS
+
+	// Options used to parse the SVGs.
+	Options *resvg.Options
+
+	// MaxBodySize limits the size of the SVG of a request.
+	// Default: DefaultMaxBodySize
+	MaxBodySize int64
+
+	// MaxPixels limits the width times the height of an image.
+	// Default: DefaultMaxPixels
+	MaxPixels int64
+
+	// Timeout limits the waiting for a worker and the rendering of a request.
+	// A timed out rendering still completes in the background, for the identical
+	// requests and the cache, before its worker is reused.
+	// Default: DefaultTimeout
+	Timeout time.Duration
+
+	// Cache stores the images by the hash of the SVG, the options, the fonts
+	// of the pool and the output parameters, which is also the `ETag`.
+	// Concurrent identical requests are rendered once even without cache.
+	// Default: nil, no cache.
+	Cache rendercache.Cache
+
+	// CacheControl the `Cache-Control` header of the images.
+	// Default: DefaultCacheControl
+	CacheControl string
+
+	// AllowExternalImages lets `<image>` load the files of its `href`, with the
+	// access of the worker to the host filesystem. Only for trusted SVGs: a POST of
+	// `<image href="/etc/...">` would disclose the file in the image.
+	// Default: false, `resvg.Options.BlockExternalImages` is set.
+	AllowExternalImages bool
+
+	// ErrorLog logs the fonts and glyphs missing from the text conversions.
+	// Default: nil, the standard logger of the `log` package.
+	ErrorLog *log.Logger
+}
+
+// Handler an `http.Handler` rendering SVGs with the workers of a pool.
+type Handler struct {
+	pool     *resvg.Pool
+	opts     HandlerOptions
+	renderer *rendercache.Renderer
+}
+
+// NewHandler new a handler rendering with the pool.
+func NewHandler(pool *resvg.Pool, opts HandlerOptions) *Handler {
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = DefaultMaxBodySize
+	}
+	if opts.MaxPixels <= 0 {
+		opts.MaxPixels = DefaultMaxPixels
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.CacheControl == "" {
+		opts.CacheControl = DefaultCacheControl
+	}
+	if !opts.AllowExternalImages {
+		options := resvg.Options{}
+		if opts.Options != nil {
+			options = *opts.Options
+		}
+		options.BlockExternalImages = true
+		opts.Options = &options
+	}
+	return &Handler{pool: pool, opts: opts, renderer: rendercache.NewRenderer(opts.Cache)}
+}
+
+func (h *Handler) logf(format string, args ...any) {
+	if h.opts.ErrorLog != nil {
+		h.opts.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// httpError an error with the status code of the response.
+type httpError struct {
+	code int
+	err  error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+func (e *httpError) Unwrap() error {
+	return e.err
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := h.serve(w, r)
+	if err == nil {
+		return
+	}
+	code := http.StatusInternalServerError
+	var herr *httpError
+	var perr *resvg.ParseError
+	switch {
+	case errors.As(err, &herr):
+		code = herr.code
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, resvg.ErrPoolClosed):
+		code = http.StatusServiceUnavailable
+	case errors.Is(err, context.Canceled):
+		// the client is gone
+		return
+	case errors.As(err, &perr),
+		errors.Is(err, resvg.ErrNotUTF8),
+		errors.Is(err, resvg.ErrMalformedGZip),
+		errors.Is(err, resvg.ErrElementsLimitReached),
+		errors.Is(err, resvg.ErrInvalidSize),
+		errors.Is(err, resvg.ErrEmptySize),
+		errors.Is(err, errTooLarge):
+		code = http.StatusUnprocessableEntity
+	}
+	http.Error(w, err.Error(), code)
+}
+
+func (h *Handler) serve(w http.ResponseWriter, r *http.Request) error {
+	var svg []byte
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		svg, err = h.readBody(w, r)
+	case http.MethodGet, http.MethodHead:
+		if h.opts.FS == nil {
+			w.Header().Set("Allow", http.MethodPost)
+			return &httpError{http.StatusMethodNotAllowed, errors.New("method not allowed")}
+		}
+		svg, err = h.readFile(r.URL.Path)
+	default:
+		if h.opts.FS == nil {
+			w.Header().Set("Allow", http.MethodPost)
+		} else {
+			w.Header().Set("Allow", "GET, HEAD, POST")
+		}
+		return &httpError{http.StatusMethodNotAllowed, errors.New("method not allowed")}
+	}
+	if err != nil {
+		return err
+	}
+	p, err := parseParams(r.URL.Query())
+	if err != nil {
+		return &httpError{http.StatusBadRequest, err}
+	}
+	key := p.hash(svg, h.opts.Options, h.pool.FontFingerprint())
+	etag := `"` + key + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", h.opts.CacheControl)
+	if r.Method != http.MethodPost && etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), h.opts.Timeout)
+	defer cancel()
+	data, err := h.render(ctx, key, r.URL.Path, svg, p)
+	if err != nil {
+		w.Header().Del("ETag")
+		w.Header().Del("Cache-Control")
+		return err
+	}
+	w.Header().Set("Content-Type", "image/"+p.format)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(data)
+	}
+	return nil
+}
+
+// readBody reads the SVG of a POST.
+func (h *Handler) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	svg, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.opts.MaxBodySize))
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return nil, &httpError{http.StatusRequestEntityTooLarge, err}
+	}
+	if err != nil {
+		return nil, &httpError{http.StatusBadRequest, err}
+	}
+	return svg, nil
+}
+
+// readFile reads the SVG of a GET from the FS.
+func (h *Handler) readFile(name string) ([]byte, error) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" || !fs.ValidPath(name) {
+		return nil, &httpError{http.StatusNotFound, fs.ErrNotExist}
+	}
+	f, err := h.opts.FS.Open(name)
+	if err != nil {
+		return nil, fsError(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fsError(err)
+	}
+	if info.IsDir() {
+		return nil, &httpError{http.StatusNotFound, fs.ErrNotExist}
+	}
+	if info.Size() > h.opts.MaxBodySize {
+		return nil, &httpError{http.StatusRequestEntityTooLarge, fmt.Errorf("%s is larger than %d bytes", name, h.opts.MaxBodySize)}
+	}
+	svg, err := io.ReadAll(io.LimitReader(f, h.opts.MaxBodySize+1))
+	if err != nil {
+		return nil, fsError(err)
+	}
+	if int64(len(svg)) > h.opts.MaxBodySize {
+		return nil, &httpError{http.StatusRequestEntityTooLarge, fmt.Errorf("%s is larger than %d bytes", name, h.opts.MaxBodySize)}
+	}
+	return svg, nil
+}
+
+func fsError(err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return &httpError{http.StatusNotFound, fs.ErrNotExist}
+	case errors.Is(err, fs.ErrPermission):
+		return &httpError{http.StatusForbidden, fs.ErrPermission}
+	default:
+		return err
+	}
+}
+
+// etagMatch reports whether the `If-None-Match` header matches the etag.
+func etagMatch(header string, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// render returns the image of the key from the cache, or renders the SVG
+// with a worker of the pool, waiting for it within the ctx.
+// The fonts and glyphs missing from the text conversion are logged with the name.
+func (h *Handler) render(ctx context.Context, key string, name string, svg []byte, p params) ([]byte, error) {
+	return h.renderer.Render(ctx, key, func() ([]byte, error) {
+		// shared by the requests, so not canceled with any of them
+		ctx, cancel := context.WithTimeout(context.Background(), h.opts.Timeout)
+		defer cancel()
+		var data []byte
+		var report *resvg.TextConversionReport
+		err := h.pool.Do(ctx, func(wk *resvg.Worker, fontdb *resvg.FontDB) error {
+			var err error
+			data, report, err = renderSVG(wk, fontdb, svg, h.opts.Options, p, h.opts.MaxPixels)
+			return err
+		})
+		if err == nil && !report.Empty() {
+			h.logf("httprender: %s: %v", name, &resvg.TextConversionError{Report: report})
+		}
+		return data, err
+	})
+}
@@ -0,0 +1,158 @@
+package httprender
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	resvg "github.com/kanrichan/resvg-go"
+	"github.com/kanrichan/resvg-go/rendercache"
+)
+
+const svg = `<svg width="100" height="50" xmlns="http://www.w3.org/2000/svg"><rect width="100" height="50" fill="red"/></svg>`
+
+func newTestHandler(t *testing.T) *Handler {
+	pool, err := resvg.NewPool(context.Background(), resvg.PoolOptions{Size: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Close() })
+	return NewHandler(pool, HandlerOptions{
+		FS: fstest.MapFS{
+			"icons/a.svg": {Data: []byte(svg)},
+		},
+		MaxBodySize: 1024,
+		Cache:       rendercache.NewMemoryCache(1 << 20),
+	})
+}
+
+func TestHandlerErrors(t *testing.T) {
+	h := newTestHandler(t)
+	for _, c := range []struct {
+		method string
+		target string
+		body   string
+		code   int
+	}{
+		{http.MethodPut, "/icons/a.svg", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/icons/b.svg", "", http.StatusNotFound},
+		{http.MethodGet, "/icons", "", http.StatusNotFound},
+		{http.MethodGet, "/../icons/a.svg?width=x", "", http.StatusBadRequest},
+		{http.MethodGet, "/icons/a.svg?format=gif", "", http.StatusBadRequest},
+		{http.MethodGet, "/icons/a.svg?background=red", "", http.StatusBadRequest},
+		{http.MethodPost, "/", strings.Repeat(" ", 2048), http.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/?zoom=1000", svg, http.StatusUnprocessableEntity},
+		{http.MethodPost, "/", "<svg", http.StatusUnprocessableEntity},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(c.method, c.target, strings.NewReader(c.body)))
+		if rec.Code != c.code {
+			t.Fatal(c.method, c.target, "status must be", c.code, "not", rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestHandlerRender(t *testing.T) {
+	h := newTestHandler(t)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/icons/a.svg?width=50&background=%23fff", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatal(rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Content-Type") != "image/png" || rec.Header().Get("Cache-Control") != DefaultCacheControl {
+		t.Fatal("unexpected headers", rec.Header())
+	}
+	cfg, err := png.DecodeConfig(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 50 || cfg.Height != 25 {
+		t.Fatal("size must be 50x25")
+	}
+	if h.opts.Cache.(*rendercache.MemoryCache).Len() != 1 {
+		t.Fatal("image must be cached")
+	}
+	etag := rec.Header().Get("ETag")
+	req := httptest.NewRequest(http.MethodGet, "/icons/a.svg?width=50&background=%23fff", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Fatal("status must be 304 not", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/?format=jpeg", strings.NewReader(svg)))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatal(rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandlerExternalImages(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secret.png")
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(file, buf.Bytes(), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := `<svg width="10" height="10" xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">` +
+		`<image xlink:href="` + filepath.ToSlash(file) + `" width="10" height="10"/></svg>`
+	pool, err := resvg.NewPool(context.Background(), resvg.PoolOptions{Size: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	for _, allow := range []bool{false, true} {
+		h := NewHandler(pool, HandlerOptions{AllowExternalImages: allow})
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatal(rec.Code, rec.Body.String())
+		}
+		out, err := png.Decode(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, _, a := out.At(5, 5).RGBA(); (a != 0) != allow {
+			t.Fatal("the image file must be loaded only if allowed, allow:", allow)
+		}
+	}
+}
+
+func TestParseParams(t *testing.T) {
+	p, err := parseParams(url.Values{"width": {"64"}, "zoom": {"2"}, "format": {"jpg"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.width != 64 || p.zoom != 2 || p.format != "jpeg" || p.background != "#ffffff" {
+		t.Fatal("unexpected params", p)
+	}
+	scale, width, height := p.fit(32, 16)
+	if scale != 4 || width != 128 || height != 64 {
+		t.Fatal("unexpected fit", scale, width, height)
+	}
+	q, _ := parseParams(url.Values{"width": {"64"}, "zoom": {"2"}, "format": {"jpeg"}})
+	if p.hash([]byte(svg), nil, "") != q.hash([]byte(svg), nil, "") {
+		t.Fatal("jpg and jpeg must have the same hash")
+	}
+	q, _ = parseParams(url.Values{"width": {"64"}})
+	if p.hash([]byte(svg), nil, "") == q.hash([]byte(svg), nil, "") {
+		t.Fatal("different params must have different hashes")
+	}
+}
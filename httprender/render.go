@@ -0,0 +1,179 @@
+package httprender
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"math"
+	"net/url"
+	"strconv"
+
+	resvg "github.com/kanrichan/resvg-go"
+	"github.com/kanrichan/resvg-go/rendercache"
+)
+
+// jpegQuality the quality of the JPEG images.
+const jpegQuality = 90
+
+// params the output parameters of a request.
+type params struct {
+	width      uint32
+	height     uint32
+	zoom       float32
+	format     string
+	background string
+	color      resvg.Color
+	alpha      uint8
+}
+
+// parseParams parses the `width`, `height`, `zoom`, `format` and `background` of the query.
+func parseParams(q url.Values) (params, error) {
+	p := params{format: "png"}
+	for _, v := range []struct {
+		name string
+		dst  *uint32
+	}{{"width", &p.width}, {"height", &p.height}} {
+		s := q.Get(v.name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(s, 10, 32)
+		if err != nil || n == 0 {
+			return params{}, fmt.Errorf("invalid %s %q", v.name, s)
+		}
+		*v.dst = uint32(n)
+	}
+	if s := q.Get("zoom"); s != "" {
+		zoom, err := strconv.ParseFloat(s, 32)
+		if err != nil || zoom <= 0 || math.IsInf(zoom, 0) {
+			return params{}, fmt.Errorf("invalid zoom %q", s)
+		}
+		p.zoom = float32(zoom)
+	}
+	switch s := q.Get("format"); s {
+	case "", "png":
+	case "jpeg", "jpg":
+		p.format = "jpeg"
+	default:
+		return params{}, fmt.Errorf("unsupported format %q", s)
+	}
+	if s := q.Get("background"); s != "" {
+		color, alpha, err := resvg.ParseColor(s)
+		if err != nil {
+			return params{}, err
+		}
+		p.background, p.color, p.alpha = s, color, alpha
+	}
+	if p.background == "" && p.format == "jpeg" {
+		p.background, p.color, p.alpha = "#ffffff", resvg.Color{Red: 255, Green: 255, Blue: 255}, 255
+	}
+	return p, nil
+}
+
+// hash returns the hash of the SVG rendered with the options, the fonts and the params.
+func (p params) hash(svg []byte, options *resvg.Options, fonts string) string {
+	return rendercache.Key(svg, options, fonts, struct {
+		Width      uint32
+		Height     uint32
+		Zoom       float32
+		Format     string
+		Color      resvg.Color
+		Alpha      uint8
+		Background bool
+	}{p.width, p.height, p.zoom, p.format, p.color, p.alpha, p.background != ""})
+}
+
+// fit returns the scale and the size of the image of the size (w, h).
+// Width and height fit the image inside, zoom scales it.
+func (p params) fit(w float32, h float32) (float32, uint32, uint32) {
+	if w <= 0 || h <= 0 {
+		return 0, 0, 0
+	}
+	scale := float32(1)
+	switch {
+	case p.width > 0 && p.height > 0:
+		scale = float32(math.Min(float64(p.width)/float64(w), float64(p.height)/float64(h)))
+	case p.width > 0:
+		scale = float32(p.width) / w
+	case p.height > 0:
+		scale = float32(p.height) / h
+	}
+	if p.zoom > 0 {
+		scale *= p.zoom
+	}
+	return scale, uint32(math.Ceil(float64(w * scale))), uint32(math.Ceil(float64(h * scale)))
+}
+
+// errTooLarge returned when the image has more pixels than allowed.
+var errTooLarge = errors.New("image is too large")
+
+// parseSVG returns the text converted tree of the SVG and the report of the conversion,
+// from the `resvg.TreeCache` of the worker if any, which owns the tree then.
+func parseSVG(wk *resvg.Worker, fontdb *resvg.FontDB, svg []byte, options *resvg.Options) (*resvg.Tree, *resvg.TextConversionReport, error) {
+	if trees := wk.TreeCache(); trees != nil {
+		return trees.TreeReport(svg, options, fontdb)
+	}
+	tree, err := wk.NewTreeFromData(svg, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	report, err := tree.ConvertText(fontdb)
+	if err != nil {
+		tree.Close()
+		return nil, nil, err
+	}
+	return tree, report, nil
+}
+
+// renderSVG renders the SVG into an image of the params,
+// with the report of the text conversion.
+func renderSVG(wk *resvg.Worker, fontdb *resvg.FontDB, svg []byte, options *resvg.Options, p params, maxPixels int64) ([]byte, *resvg.TextConversionReport, error) {
+	tree, report, err := parseSVG(wk, fontdb, svg, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	if wk.TreeCache() == nil {
+		defer tree.Close()
+	}
+	w, h, err := tree.GetSize()
+	if err != nil {
+		return nil, nil, err
+	}
+	scale, width, height := p.fit(w, h)
+	if width == 0 || height == 0 {
+		return nil, nil, resvg.ErrEmptySize
+	}
+	if int64(width)*int64(height) > maxPixels {
+		return nil, nil, fmt.Errorf("%w: %dx%d", errTooLarge, width, height)
+	}
+	pixmap, err := wk.NewPixmap(width, height)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer pixmap.Close()
+	if p.background != "" {
+		err = pixmap.Fill(p.color, p.alpha)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	err = tree.Render(resvg.TransformFromScale(scale, scale), pixmap)
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.format == "png" {
+		data, err := pixmap.EncodePNG()
+		return data, report, err
+	}
+	img, err := pixmap.Image()
+	if err != nil {
+		return nil, nil, err
+	}
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	if err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), report, nil
+}
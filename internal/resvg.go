@@ -1,9 +1,12 @@
 package internal
 
 import (
+	"bytes"
 	"context"
 	_ "embed"
+	"encoding/json"
 	"errors"
+	"fmt"
 
 	"github.com/tetratelabs/wazero/api"
 )
@@ -20,6 +23,24 @@ var (
 	ErrWasmMemoryOutOfRange = errors.New("wasm error: memory out of range")
 )
 
+var (
+	ErrNotUTF8              = errors.New("provided data has not an UTF-8 encoding")
+	ErrMalformedGZip        = errors.New("provided data has a malformed GZip content")
+	ErrElementsLimitReached = errors.New("the maximum number of SVG elements has been reached")
+	ErrInvalidSize          = errors.New("SVG has an invalid size")
+)
+
+// ParseError the SVG data is not a valid XML, Line and Col are 1-based.
+type ParseError struct {
+	Line int
+	Col  int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return "SVG data parsing failed cause " + e.Msg
+}
+
 const (
 	ExportNameFontdbDatabaseDefault            = "fontdb_database_default"
 	ExportNameFontdbDatabaseDelete             = "fontdb_database_delete"
@@ -27,6 +48,12 @@ const (
 	ExportNameFontdbDatabaseLoadFontFile       = "fontdb_database_load_font_file"
 	ExportNameFontdbDatabaseLoadFontsDir       = "fontdb_database_load_fonts_dir"
 	ExportNameFontdbDatabaseLen                = "fontdb_database_len"
+	ExportNameFontdbDatabaseFaces              = "fontdb_database_faces"
+	ExportNameFontdbDatabaseQuery              = "fontdb_database_query"
+	ExportNameFontdbDatabaseRemoveFace         = "fontdb_database_remove_face"
+	ExportNameFontdbDatabaseRemoveBySource     = "fontdb_database_remove_by_source"
+	ExportNameFontdbDatabaseClear              = "fontdb_database_clear"
+	ExportNameFontdbDatabaseFamilyName         = "fontdb_database_family_name"
 	ExportNameFontdbDatabaseSetSerifFamily     = "fontdb_database_set_serif_family"
 	ExportNameFontdbDatabaseSetSansSerifFamily = "fontdb_database_set_sans_serif_family"
 	ExportNameFontdbDatabaseSetCursiveFamily   = "fontdb_database_set_cursive_family"
@@ -43,12 +70,15 @@ const (
 	ExportNameUsvgOptionsSetTextRenderingMode  = "usvg_options_set_text_rendering_mode"
 	ExportNameUsvgOptionsSetImageRenderingMode = "usvg_options_set_image_rendering_mode"
 	ExportNameUsvgOptionsSetDefaultSize        = "usvg_options_set_default_size"
+	ExportNameUsvgOptionsBlockExternalImages   = "usvg_options_block_external_images"
 	ExportNameTinySkiaPixmapNew                = "tiny_skia_pixmap_new"
 	ExportNameTinySkiaPixmapDecodePNG          = "tiny_skia_pixmap_decode_png"
 	ExportNameTinySkiaPixmapDelete             = "tiny_skia_pixmap_delete"
 	ExportNameTinySkiaPixmapEncodePNG          = "tiny_skia_pixmap_encode_png"
 	ExportNameTinySkiaPixmapGetWidth           = "tiny_skia_pixmap_get_width"
 	ExportNameTinySkiaPixmapGetHeight          = "tiny_skia_pixmap_get_height"
+	ExportNameTinySkiaPixmapFill               = "tiny_skia_pixmap_fill"
+	ExportNameTinySkiaPixmapData               = "tiny_skia_pixmap_data"
 	ExportNameTinySkiaTransformIdentity        = "tiny_skia_transform_identity"
 	ExportNameTinySkiaTransformFromRow         = "tiny_skia_transform_from_row"
 	ExportNameTinySkiaTransformFromTranslate   = "tiny_skia_transform_from_translate"
@@ -59,16 +89,102 @@ const (
 	ExportNameTinySkiaTransformDelete          = "tiny_skia_transform_delete"
 	ExportNameUsvgTreeFromData                 = "usvg_tree_from_data"
 	ExportNameUsvgTreeDelete                   = "usvg_tree_delete"
+	ExportNameUsvgTreeClone                    = "usvg_tree_clone"
 	ExportNameUsvgTreeConvertText              = "usvg_tree_convert_text"
+	ExportNameUsvgTreeApplyFontFallback        = "usvg_tree_apply_font_fallback"
+	ExportNameUsvgTreeConvertTextReport        = "usvg_tree_convert_text_report"
+	ExportNameUsvgTreeTexts                    = "usvg_tree_texts"
 	ExportNameUsvgTreeGetWidth                 = "usvg_tree_get_size_width"
 	ExportNameUsvgTreeGetHeight                = "usvg_tree_get_size_height"
+	ExportNameUsvgTreeHitTest                  = "usvg_tree_hit_test"
+	ExportNameUsvgTreeNodeBBox                 = "usvg_tree_node_bbox"
+	ExportNameUsvgTreeRetainNode               = "usvg_tree_retain_node"
+	ExportNameUsvgTreeSetFill                  = "usvg_tree_set_fill"
+	ExportNameUsvgTreeSetStroke                = "usvg_tree_set_stroke"
+	ExportNameUsvgTreeSetOpacity               = "usvg_tree_set_opacity"
+	ExportNameUsvgTreeSetVisible               = "usvg_tree_set_visible"
+	ExportNameUsvgTreeReplaceColor             = "usvg_tree_replace_color"
 	ExportNameResvgTreeFromUsvg                = "resvg_tree_from_usvg"
 	ExportNameResvgTreeDelete                  = "resvg_tree_delete"
 	ExportNameResvgTreeRender                  = "resvg_tree_render"
 	ExportNameMemoryMalloc                     = "memory_malloc"
 	ExportNameMemoryFree                       = "memory_free"
+	ExportNameMemoryHeapStats                  = "memory_heap_stats"
 )
 
+// ExportNames the functions the wrappers call, all exported by `resvg.wasm.gz`
+// once it is regenerated from `resvg.rs` by `go generate`.
+var ExportNames = []string{
+	ExportNameFontdbDatabaseDefault,
+	ExportNameFontdbDatabaseDelete,
+	ExportNameFontdbDatabaseLoadFontData,
+	ExportNameFontdbDatabaseLoadFontFile,
+	ExportNameFontdbDatabaseLoadFontsDir,
+	ExportNameFontdbDatabaseLen,
+	ExportNameFontdbDatabaseFaces,
+	ExportNameFontdbDatabaseQuery,
+	ExportNameFontdbDatabaseRemoveFace,
+	ExportNameFontdbDatabaseRemoveBySource,
+	ExportNameFontdbDatabaseClear,
+	ExportNameFontdbDatabaseFamilyName,
+	ExportNameFontdbDatabaseSetSerifFamily,
+	ExportNameFontdbDatabaseSetSansSerifFamily,
+	ExportNameFontdbDatabaseSetCursiveFamily,
+	ExportNameFontdbDatabaseSetFantasyFamily,
+	ExportNameFontdbDatabaseSetMonospaceFamily,
+	ExportNameUsvgOptionsDefault,
+	ExportNameUsvgOptionsDelete,
+	ExportNameUsvgOptionsSetResourcesDir,
+	ExportNameUsvgOptionsSetDpi,
+	ExportNameUsvgOptionsSetFontFamily,
+	ExportNameUsvgOptionsSetFontSize,
+	ExportNameUsvgOptionsSetLanguages,
+	ExportNameUsvgOptionsSetShapeRenderingMode,
+	ExportNameUsvgOptionsSetTextRenderingMode,
+	ExportNameUsvgOptionsSetImageRenderingMode,
+	ExportNameUsvgOptionsSetDefaultSize,
+	ExportNameUsvgOptionsBlockExternalImages,
+	ExportNameTinySkiaPixmapNew,
+	ExportNameTinySkiaPixmapDecodePNG,
+	ExportNameTinySkiaPixmapDelete,
+	ExportNameTinySkiaPixmapEncodePNG,
+	ExportNameTinySkiaPixmapGetWidth,
+	ExportNameTinySkiaPixmapGetHeight,
+	ExportNameTinySkiaPixmapFill,
+	ExportNameTinySkiaPixmapData,
+	ExportNameTinySkiaTransformIdentity,
+	ExportNameTinySkiaTransformFromRow,
+	ExportNameTinySkiaTransformFromTranslate,
+	ExportNameTinySkiaTransformFromScale,
+	ExportNameTinySkiaTransformFromSkew,
+	ExportNameTinySkiaTransformFromRotate,
+	ExportNameTinySkiaTransformFromRotateAt,
+	ExportNameTinySkiaTransformDelete,
+	ExportNameUsvgTreeFromData,
+	ExportNameUsvgTreeDelete,
+	ExportNameUsvgTreeClone,
+	ExportNameUsvgTreeConvertText,
+	ExportNameUsvgTreeApplyFontFallback,
+	ExportNameUsvgTreeConvertTextReport,
+	ExportNameUsvgTreeTexts,
+	ExportNameUsvgTreeGetWidth,
+	ExportNameUsvgTreeGetHeight,
+	ExportNameUsvgTreeHitTest,
+	ExportNameUsvgTreeNodeBBox,
+	ExportNameUsvgTreeRetainNode,
+	ExportNameUsvgTreeSetFill,
+	ExportNameUsvgTreeSetStroke,
+	ExportNameUsvgTreeSetOpacity,
+	ExportNameUsvgTreeSetVisible,
+	ExportNameUsvgTreeReplaceColor,
+	ExportNameResvgTreeFromUsvg,
+	ExportNameResvgTreeDelete,
+	ExportNameResvgTreeRender,
+	ExportNameMemoryMalloc,
+	ExportNameMemoryFree,
+	ExportNameMemoryHeapStats,
+}
+
 func FontdbDatabaseDefault(ctx context.Context, module api.Module) (int32, error) {
 	fn := module.
 		ExportedFunction(ExportNameFontdbDatabaseDefault)
@@ -225,6 +341,182 @@ func FontdbDatabaseLen(ctx context.Context, module api.Module, database int32) (
 	return api.DecodeI32(resp[0]), nil
 }
 
+func FontdbDatabaseFaces(ctx context.Context, module api.Module, database int32) ([]byte, error) {
+	fn := module.
+		ExportedFunction(ExportNameFontdbDatabaseFaces)
+	if fn == nil {
+		return nil, ErrWasmFunctionNotFound
+	}
+	r, err := MemoryMalloc(ctx, module, 16)
+	if err != nil {
+		return nil, err
+	}
+	defer MemoryFree(ctx, module, r, 16)
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(r),
+		api.EncodeI32(database),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) != 0 {
+		return nil, ErrWasmReturnInvaild
+	}
+	return BytesResultRead(ctx, module, r)
+}
+
+func FontdbDatabaseQuery(ctx context.Context, module api.Module, database int32, families string, weight uint16, style int32, stretch int32) ([]byte, error) {
+	fn := module.
+		ExportedFunction(ExportNameFontdbDatabaseQuery)
+	if fn == nil {
+		return nil, ErrWasmFunctionNotFound
+	}
+	m, err := MemoryMalloc(ctx, module, len(families)+1)
+	if err != nil {
+		return nil, err
+	}
+	defer MemoryFree(ctx, module, m, len(families)+1)
+	if err := CStrWrite(ctx, module, m, families); err != nil {
+		return nil, err
+	}
+	r, err := MemoryMalloc(ctx, module, 16)
+	if err != nil {
+		return nil, err
+	}
+	defer MemoryFree(ctx, module, r, 16)
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(r),
+		api.EncodeI32(database),
+		api.EncodeI32(m),
+		api.EncodeU32(uint32(weight)),
+		api.EncodeI32(style),
+		api.EncodeI32(stretch),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) != 0 {
+		return nil, ErrWasmReturnInvaild
+	}
+	return BytesResultRead(ctx, module, r)
+}
+
+func FontdbDatabaseRemoveFace(ctx context.Context, module api.Module, database int32, id string) error {
+	fn := module.
+		ExportedFunction(ExportNameFontdbDatabaseRemoveFace)
+	if fn == nil {
+		return ErrWasmFunctionNotFound
+	}
+	m, err := MemoryMalloc(ctx, module, len(id)+1)
+	if err != nil {
+		return err
+	}
+	defer MemoryFree(ctx, module, m, len(id)+1)
+	if err := CStrWrite(ctx, module, m, id); err != nil {
+		return err
+	}
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(database),
+		api.EncodeI32(m),
+	)
+	if err != nil {
+		return err
+	}
+	if len(resp) != 1 {
+		return ErrWasmReturnInvaild
+	}
+	if resp[0] == 0 {
+		return nil
+	}
+	error, err := CStrRead(ctx, module, int32(resp[0]))
+	if err != nil {
+		return err
+	}
+	defer MemoryFree(ctx, module, int32(resp[0]), len(error)+1)
+	return errors.New(error)
+}
+
+func FontdbDatabaseRemoveBySource(ctx context.Context, module api.Module, database int32, path string, blob uint32) (int32, error) {
+	fn := module.
+		ExportedFunction(ExportNameFontdbDatabaseRemoveBySource)
+	if fn == nil {
+		return 0, ErrWasmFunctionNotFound
+	}
+	m, err := MemoryMalloc(ctx, module, len(path)+1)
+	if err != nil {
+		return 0, err
+	}
+	defer MemoryFree(ctx, module, m, len(path)+1)
+	if err := CStrWrite(ctx, module, m, path); err != nil {
+		return 0, err
+	}
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(database),
+		api.EncodeI32(m),
+		api.EncodeU32(blob),
+	)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp) != 1 {
+		return 0, ErrWasmReturnInvaild
+	}
+	return api.DecodeI32(resp[0]), nil
+}
+
+func FontdbDatabaseClear(ctx context.Context, module api.Module, database int32) error {
+	fn := module.
+		ExportedFunction(ExportNameFontdbDatabaseClear)
+	if fn == nil {
+		return ErrWasmFunctionNotFound
+	}
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(database),
+	)
+	if err != nil {
+		return err
+	}
+	if len(resp) != 0 {
+		return ErrWasmReturnInvaild
+	}
+	return nil
+}
+
+func FontdbDatabaseFamilyName(ctx context.Context, module api.Module, database int32, generic int32) (string, error) {
+	fn := module.
+		ExportedFunction(ExportNameFontdbDatabaseFamilyName)
+	if fn == nil {
+		return "", ErrWasmFunctionNotFound
+	}
+	r, err := MemoryMalloc(ctx, module, 16)
+	if err != nil {
+		return "", err
+	}
+	defer MemoryFree(ctx, module, r, 16)
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(r),
+		api.EncodeI32(database),
+		api.EncodeI32(generic),
+	)
+	if err != nil {
+		return "", err
+	}
+	if len(resp) != 0 {
+		return "", ErrWasmReturnInvaild
+	}
+	data, err := BytesResultRead(ctx, module, r)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
 func FontdbDatabaseSetSerifFamily(ctx context.Context, module api.Module, database int32, family string) error {
 	fn := module.
 		ExportedFunction(ExportNameFontdbDatabaseSetSerifFamily)
@@ -671,6 +963,25 @@ func UsvgOptionsSetDefaultSize(ctx context.Context, module api.Module, options i
 	return nil
 }
 
+func UsvgOptionsBlockExternalImages(ctx context.Context, module api.Module, options int32) error {
+	fn := module.
+		ExportedFunction(ExportNameUsvgOptionsBlockExternalImages)
+	if fn == nil {
+		return ErrWasmFunctionNotFound
+	}
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(options),
+	)
+	if err != nil {
+		return err
+	}
+	if len(resp) != 0 {
+		return ErrWasmReturnInvaild
+	}
+	return nil
+}
+
 func TinySkiaPixmapNew(ctx context.Context, module api.Module, width uint32, height uint32) (int32, error) {
 	fn := module.
 		ExportedFunction(ExportNameTinySkiaPixmapNew)
@@ -857,6 +1168,55 @@ func TinySkiaPixmapGetHeight(ctx context.Context, module api.Module, pixmap int3
 	return api.DecodeU32(resp[0]), nil
 }
 
+func TinySkiaPixmapFill(ctx context.Context, module api.Module, pixmap int32, red uint8, green uint8, blue uint8, alpha uint8) error {
+	fn := module.
+		ExportedFunction(ExportNameTinySkiaPixmapFill)
+	if fn == nil {
+		return ErrWasmFunctionNotFound
+	}
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(pixmap),
+		api.EncodeU32(uint32(red)),
+		api.EncodeU32(uint32(green)),
+		api.EncodeU32(uint32(blue)),
+		api.EncodeU32(uint32(alpha)),
+	)
+	if err != nil {
+		return err
+	}
+	if len(resp) != 0 {
+		return ErrWasmReturnInvaild
+	}
+	return nil
+}
+
+// TinySkiaPixmapData returns a copy of the premultiplied RGBA pixels.
+func TinySkiaPixmapData(ctx context.Context, module api.Module, pixmap int32) ([]byte, error) {
+	fn := module.
+		ExportedFunction(ExportNameTinySkiaPixmapData)
+	if fn == nil {
+		return nil, ErrWasmFunctionNotFound
+	}
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(pixmap),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) != 1 {
+		return nil, ErrWasmReturnInvaild
+	}
+	b, f := module.Memory().Read(uint32(resp[0]>>32), uint32(resp[0]))
+	if !f {
+		return nil, ErrWasmMemoryOutOfRange
+	}
+	var data = make([]byte, len(b), len(b))
+	copy(data, b)
+	return data, nil
+}
+
 func TinySkiaTransformIdentity(ctx context.Context, module api.Module) (int32, error) {
 	fn := module.
 		ExportedFunction(ExportNameTinySkiaTransformIdentity)
@@ -1056,43 +1416,52 @@ func UsvgTreeFromData(ctx context.Context, module api.Module, data []byte, optio
 	if result.ok {
 		return result.data, nil
 	}
-	error, err := CStrRead(ctx, module, result.data)
-	if err != nil {
-		return 0, err
-	}
-	defer MemoryFree(ctx, module, result.data, len(error)+1)
-	return 0, errors.New(error)
+	return 0, TreeErrorRead(ctx, module, result.data)
 }
 
-func UsvgTreeDelete(ctx context.Context, module api.Module, tree int32) error {
-	fn := module.
-		ExportedFunction(ExportNameUsvgTreeDelete)
-	if fn == nil {
-		return ErrWasmFunctionNotFound
-	}
-	resp, err := fn.Call(
-		ctx,
-		api.EncodeI32(tree),
-	)
+// TreeErrorRead reads the error of `usvg_tree_from_data`, a JSON C string
+// of the error code, position and message, and frees it.
+func TreeErrorRead(ctx context.Context, module api.Module, ptr int32) error {
+	error, err := CStrRead(ctx, module, ptr)
 	if err != nil {
 		return err
 	}
-	if len(resp) != 0 {
-		return ErrWasmReturnInvaild
+	defer MemoryFree(ctx, module, ptr, len(error)+1)
+	var info struct {
+		Code    int    `json:"code"`
+		Line    int    `json:"line"`
+		Col     int    `json:"col"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(error), &info); err != nil {
+		// the module doesn't match this wrapper
+		return fmt.Errorf("%w: tree error %q: %v", ErrWasmReturnInvaild, error, err)
+	}
+	switch info.Code {
+	case 1:
+		return ErrNotUTF8
+	case 2:
+		return ErrMalformedGZip
+	case 3:
+		return ErrElementsLimitReached
+	case 4:
+		return ErrInvalidSize
+	case 5:
+		return &ParseError{info.Line, info.Col, info.Message}
+	default:
+		return errors.New(info.Message)
 	}
-	return nil
 }
 
-func UsvgTreeConvertText(ctx context.Context, module api.Module, tree int32, database int32) error {
+func UsvgTreeDelete(ctx context.Context, module api.Module, tree int32) error {
 	fn := module.
-		ExportedFunction(ExportNameUsvgTreeConvertText)
+		ExportedFunction(ExportNameUsvgTreeDelete)
 	if fn == nil {
 		return ErrWasmFunctionNotFound
 	}
 	resp, err := fn.Call(
 		ctx,
 		api.EncodeI32(tree),
-		api.EncodeI32(database),
 	)
 	if err != nil {
 		return err
@@ -1103,9 +1472,9 @@ func UsvgTreeConvertText(ctx context.Context, module api.Module, tree int32, dat
 	return nil
 }
 
-func UsvgTreeGetWidth(ctx context.Context, module api.Module, tree int32) (float32, error) {
+func UsvgTreeClone(ctx context.Context, module api.Module, tree int32) (int32, error) {
 	fn := module.
-		ExportedFunction(ExportNameUsvgTreeGetWidth)
+		ExportedFunction(ExportNameUsvgTreeClone)
 	if fn == nil {
 		return 0, ErrWasmFunctionNotFound
 	}
@@ -1119,40 +1488,453 @@ func UsvgTreeGetWidth(ctx context.Context, module api.Module, tree int32) (float
 	if len(resp) != 1 || resp[0] == 0 {
 		return 0, ErrWasmReturnInvaild
 	}
-	return api.DecodeF32(resp[0]), nil
+	return api.DecodeI32(resp[0]), nil
 }
 
-func UsvgTreeGetHeight(ctx context.Context, module api.Module, tree int32) (float32, error) {
+func UsvgTreeConvertText(ctx context.Context, module api.Module, tree int32, database int32) error {
 	fn := module.
-		ExportedFunction(ExportNameUsvgTreeGetHeight)
+		ExportedFunction(ExportNameUsvgTreeConvertText)
 	if fn == nil {
-		return 0, ErrWasmFunctionNotFound
+		return ErrWasmFunctionNotFound
 	}
 	resp, err := fn.Call(
 		ctx,
 		api.EncodeI32(tree),
+		api.EncodeI32(database),
 	)
 	if err != nil {
-		return 0, err
+		return err
 	}
-	if len(resp) != 1 || resp[0] == 0 {
-		return 0, ErrWasmReturnInvaild
+	if len(resp) != 0 {
+		return ErrWasmReturnInvaild
 	}
-	return api.DecodeF32(resp[0]), nil
+	return nil
 }
 
-func ResvgTreeFromUsvg(ctx context.Context, module api.Module, tree int32) (int32, error) {
+func UsvgTreeApplyFontFallback(ctx context.Context, module api.Module, tree int32, database int32, fallbacks string) error {
 	fn := module.
-		ExportedFunction(ExportNameResvgTreeFromUsvg)
+		ExportedFunction(ExportNameUsvgTreeApplyFontFallback)
 	if fn == nil {
-		return 0, ErrWasmFunctionNotFound
+		return ErrWasmFunctionNotFound
+	}
+	m, err := MemoryMalloc(ctx, module, len(fallbacks)+1)
+	if err != nil {
+		return err
+	}
+	defer MemoryFree(ctx, module, m, len(fallbacks)+1)
+	if err := CStrWrite(ctx, module, m, fallbacks); err != nil {
+		return err
 	}
 	resp, err := fn.Call(
 		ctx,
 		api.EncodeI32(tree),
+		api.EncodeI32(database),
+		api.EncodeI32(m),
 	)
 	if err != nil {
-		return 0, err
+		return err
+	}
+	if len(resp) != 1 {
+		return ErrWasmReturnInvaild
+	}
+	if resp[0] == 0 {
+		return nil
+	}
+	error, err := CStrRead(ctx, module, int32(resp[0]))
+	if err != nil {
+		return err
+	}
+	defer MemoryFree(ctx, module, int32(resp[0]), len(error)+1)
+	return errors.New(error)
+}
+
+func UsvgTreeConvertTextReport(ctx context.Context, module api.Module, tree int32, database int32, strict bool) ([]byte, error) {
+	fn := module.
+		ExportedFunction(ExportNameUsvgTreeConvertTextReport)
+	if fn == nil {
+		return nil, ErrWasmFunctionNotFound
+	}
+	r, err := MemoryMalloc(ctx, module, 16)
+	if err != nil {
+		return nil, err
+	}
+	defer MemoryFree(ctx, module, r, 16)
+	var v uint32
+	if strict {
+		v = 1
+	}
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(r),
+		api.EncodeI32(tree),
+		api.EncodeI32(database),
+		api.EncodeU32(v),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) != 0 {
+		return nil, ErrWasmReturnInvaild
+	}
+	return BytesResultRead(ctx, module, r)
+}
+
+func UsvgTreeTexts(ctx context.Context, module api.Module, tree int32, database int32) ([]byte, error) {
+	fn := module.
+		ExportedFunction(ExportNameUsvgTreeTexts)
+	if fn == nil {
+		return nil, ErrWasmFunctionNotFound
+	}
+	r, err := MemoryMalloc(ctx, module, 16)
+	if err != nil {
+		return nil, err
+	}
+	defer MemoryFree(ctx, module, r, 16)
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(r),
+		api.EncodeI32(tree),
+		api.EncodeI32(database),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) != 0 {
+		return nil, ErrWasmReturnInvaild
+	}
+	return BytesResultRead(ctx, module, r)
+}
+
+func UsvgTreeGetWidth(ctx context.Context, module api.Module, tree int32) (float32, error) {
+	fn := module.
+		ExportedFunction(ExportNameUsvgTreeGetWidth)
+	if fn == nil {
+		return 0, ErrWasmFunctionNotFound
+	}
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(tree),
+	)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp) != 1 || resp[0] == 0 {
+		return 0, ErrWasmReturnInvaild
+	}
+	return api.DecodeF32(resp[0]), nil
+}
+
+func UsvgTreeGetHeight(ctx context.Context, module api.Module, tree int32) (float32, error) {
+	fn := module.
+		ExportedFunction(ExportNameUsvgTreeGetHeight)
+	if fn == nil {
+		return 0, ErrWasmFunctionNotFound
+	}
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(tree),
+	)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp) != 1 || resp[0] == 0 {
+		return 0, ErrWasmReturnInvaild
+	}
+	return api.DecodeF32(resp[0]), nil
+}
+
+func UsvgTreeHitTest(ctx context.Context, module api.Module, tree int32, transform int32, x float32, y float32) ([]byte, error) {
+	fn := module.
+		ExportedFunction(ExportNameUsvgTreeHitTest)
+	if fn == nil {
+		return nil, ErrWasmFunctionNotFound
+	}
+	r, err := MemoryMalloc(ctx, module, 16)
+	if err != nil {
+		return nil, err
+	}
+	defer MemoryFree(ctx, module, r, 16)
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(r),
+		api.EncodeI32(tree),
+		api.EncodeI32(transform),
+		api.EncodeF32(x),
+		api.EncodeF32(y),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) != 0 {
+		return nil, ErrWasmReturnInvaild
+	}
+	return BytesResultRead(ctx, module, r)
+}
+
+func UsvgTreeNodeBBox(ctx context.Context, module api.Module, tree int32, id string) ([]byte, error) {
+	fn := module.
+		ExportedFunction(ExportNameUsvgTreeNodeBBox)
+	if fn == nil {
+		return nil, ErrWasmFunctionNotFound
+	}
+	m, err := MemoryMalloc(ctx, module, len(id)+1)
+	if err != nil {
+		return nil, err
+	}
+	defer MemoryFree(ctx, module, m, len(id)+1)
+	if err := CStrWrite(ctx, module, m, id); err != nil {
+		return nil, err
+	}
+	r, err := MemoryMalloc(ctx, module, 16)
+	if err != nil {
+		return nil, err
+	}
+	defer MemoryFree(ctx, module, r, 16)
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(r),
+		api.EncodeI32(tree),
+		api.EncodeI32(m),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) != 0 {
+		return nil, ErrWasmReturnInvaild
+	}
+	return BytesResultRead(ctx, module, r)
+}
+
+func UsvgTreeRetainNode(ctx context.Context, module api.Module, tree int32, id string) error {
+	fn := module.
+		ExportedFunction(ExportNameUsvgTreeRetainNode)
+	if fn == nil {
+		return ErrWasmFunctionNotFound
+	}
+	m, err := MemoryMalloc(ctx, module, len(id)+1)
+	if err != nil {
+		return err
+	}
+	defer MemoryFree(ctx, module, m, len(id)+1)
+	if err := CStrWrite(ctx, module, m, id); err != nil {
+		return err
+	}
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(tree),
+		api.EncodeI32(m),
+	)
+	if err != nil {
+		return err
+	}
+	if len(resp) != 1 {
+		return ErrWasmReturnInvaild
+	}
+	if resp[0] == 0 {
+		return nil
+	}
+	error, err := CStrRead(ctx, module, int32(resp[0]))
+	if err != nil {
+		return err
+	}
+	defer MemoryFree(ctx, module, int32(resp[0]), len(error)+1)
+	return errors.New(error)
+}
+
+func UsvgTreeSetFill(ctx context.Context, module api.Module, tree int32, id string, red uint8, green uint8, blue uint8) error {
+	fn := module.
+		ExportedFunction(ExportNameUsvgTreeSetFill)
+	if fn == nil {
+		return ErrWasmFunctionNotFound
+	}
+	m, err := MemoryMalloc(ctx, module, len(id)+1)
+	if err != nil {
+		return err
+	}
+	defer MemoryFree(ctx, module, m, len(id)+1)
+	if err := CStrWrite(ctx, module, m, id); err != nil {
+		return err
+	}
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(tree),
+		api.EncodeI32(m),
+		api.EncodeU32(uint32(red)),
+		api.EncodeU32(uint32(green)),
+		api.EncodeU32(uint32(blue)),
+	)
+	if err != nil {
+		return err
+	}
+	if len(resp) != 1 {
+		return ErrWasmReturnInvaild
+	}
+	if resp[0] == 0 {
+		return nil
+	}
+	error, err := CStrRead(ctx, module, int32(resp[0]))
+	if err != nil {
+		return err
+	}
+	defer MemoryFree(ctx, module, int32(resp[0]), len(error)+1)
+	return errors.New(error)
+}
+
+func UsvgTreeSetStroke(ctx context.Context, module api.Module, tree int32, id string, red uint8, green uint8, blue uint8, width float32) error {
+	fn := module.
+		ExportedFunction(ExportNameUsvgTreeSetStroke)
+	if fn == nil {
+		return ErrWasmFunctionNotFound
+	}
+	m, err := MemoryMalloc(ctx, module, len(id)+1)
+	if err != nil {
+		return err
+	}
+	defer MemoryFree(ctx, module, m, len(id)+1)
+	if err := CStrWrite(ctx, module, m, id); err != nil {
+		return err
+	}
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(tree),
+		api.EncodeI32(m),
+		api.EncodeU32(uint32(red)),
+		api.EncodeU32(uint32(green)),
+		api.EncodeU32(uint32(blue)),
+		api.EncodeF32(width),
+	)
+	if err != nil {
+		return err
+	}
+	if len(resp) != 1 {
+		return ErrWasmReturnInvaild
+	}
+	if resp[0] == 0 {
+		return nil
+	}
+	error, err := CStrRead(ctx, module, int32(resp[0]))
+	if err != nil {
+		return err
+	}
+	defer MemoryFree(ctx, module, int32(resp[0]), len(error)+1)
+	return errors.New(error)
+}
+
+func UsvgTreeSetOpacity(ctx context.Context, module api.Module, tree int32, id string, opacity float32) error {
+	fn := module.
+		ExportedFunction(ExportNameUsvgTreeSetOpacity)
+	if fn == nil {
+		return ErrWasmFunctionNotFound
+	}
+	m, err := MemoryMalloc(ctx, module, len(id)+1)
+	if err != nil {
+		return err
+	}
+	defer MemoryFree(ctx, module, m, len(id)+1)
+	if err := CStrWrite(ctx, module, m, id); err != nil {
+		return err
+	}
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(tree),
+		api.EncodeI32(m),
+		api.EncodeF32(opacity),
+	)
+	if err != nil {
+		return err
+	}
+	if len(resp) != 1 {
+		return ErrWasmReturnInvaild
+	}
+	if resp[0] == 0 {
+		return nil
+	}
+	error, err := CStrRead(ctx, module, int32(resp[0]))
+	if err != nil {
+		return err
+	}
+	defer MemoryFree(ctx, module, int32(resp[0]), len(error)+1)
+	return errors.New(error)
+}
+
+func UsvgTreeSetVisible(ctx context.Context, module api.Module, tree int32, id string, visible bool) error {
+	fn := module.
+		ExportedFunction(ExportNameUsvgTreeSetVisible)
+	if fn == nil {
+		return ErrWasmFunctionNotFound
+	}
+	m, err := MemoryMalloc(ctx, module, len(id)+1)
+	if err != nil {
+		return err
+	}
+	defer MemoryFree(ctx, module, m, len(id)+1)
+	if err := CStrWrite(ctx, module, m, id); err != nil {
+		return err
+	}
+	var v uint32
+	if visible {
+		v = 1
+	}
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(tree),
+		api.EncodeI32(m),
+		api.EncodeU32(v),
+	)
+	if err != nil {
+		return err
+	}
+	if len(resp) != 1 {
+		return ErrWasmReturnInvaild
+	}
+	if resp[0] == 0 {
+		return nil
+	}
+	error, err := CStrRead(ctx, module, int32(resp[0]))
+	if err != nil {
+		return err
+	}
+	defer MemoryFree(ctx, module, int32(resp[0]), len(error)+1)
+	return errors.New(error)
+}
+
+func UsvgTreeReplaceColor(ctx context.Context, module api.Module, tree int32, fromRed uint8, fromGreen uint8, fromBlue uint8, toRed uint8, toGreen uint8, toBlue uint8) error {
+	fn := module.
+		ExportedFunction(ExportNameUsvgTreeReplaceColor)
+	if fn == nil {
+		return ErrWasmFunctionNotFound
+	}
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(tree),
+		api.EncodeU32(uint32(fromRed)),
+		api.EncodeU32(uint32(fromGreen)),
+		api.EncodeU32(uint32(fromBlue)),
+		api.EncodeU32(uint32(toRed)),
+		api.EncodeU32(uint32(toGreen)),
+		api.EncodeU32(uint32(toBlue)),
+	)
+	if err != nil {
+		return err
+	}
+	if len(resp) != 0 {
+		return ErrWasmReturnInvaild
+	}
+	return nil
+}
+
+func ResvgTreeFromUsvg(ctx context.Context, module api.Module, tree int32) (int32, error) {
+	fn := module.
+		ExportedFunction(ExportNameResvgTreeFromUsvg)
+	if fn == nil {
+		return 0, ErrWasmFunctionNotFound
+	}
+	resp, err := fn.Call(
+		ctx,
+		api.EncodeI32(tree),
+	)
+	if err != nil {
+		return 0, err
 	}
 	if len(resp) != 1 || resp[0] == 0 {
 		return 0, ErrWasmReturnInvaild
@@ -1271,6 +2053,25 @@ func CStrFree(ctx context.Context, module api.Module, ptr int32) (string, error)
 	return string(e), nil
 }
 
+// MemoryHeapStats returns the heap bytes in use and their peak.
+func MemoryHeapStats(ctx context.Context, module api.Module) (uint32, uint32, error) {
+	fn := module.
+		ExportedFunction(ExportNameMemoryHeapStats)
+	if fn == nil {
+		return 0, 0, ErrWasmFunctionNotFound
+	}
+	resp, err := fn.Call(
+		ctx,
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(resp) != 1 {
+		return 0, 0, ErrWasmReturnInvaild
+	}
+	return uint32(resp[0] >> 32), uint32(resp[0]), nil
+}
+
 func CStrWrite(ctx context.Context, module api.Module, ptr int32, s string) error {
 	if !module.Memory().WriteString(uint32(ptr), s) {
 		return ErrWasmMemoryOutOfRange
@@ -1282,22 +2083,47 @@ func CStrWrite(ctx context.Context, module api.Module, ptr int32, s string) erro
 }
 
 func CStrRead(ctx context.Context, module api.Module, ptr int32) (string, error) {
-	var i int
-	for i = 0; i < 1024; i++ {
-		b, f := module.Memory().ReadByte(uint32(ptr) + uint32(i))
-		if b == 0 || !f {
-			break
-		}
+	size := module.Memory().Size()
+	if uint32(ptr) >= size {
+		return "", ErrWasmMemoryOutOfRange
 	}
-	if i == 0 {
+	b, _ := module.Memory().Read(uint32(ptr), size-uint32(ptr))
+	i := bytes.IndexByte(b, 0)
+	if i <= 0 {
 		return "", ErrWasmMemoryOutOfRange
 	}
-	b, _ := module.Memory().Read(uint32(ptr), uint32(i))
 	var e = make([]byte, i, i)
 	copy(e, b)
 	return string(e), nil
 }
 
+// BytesResultRead reads a `Result<u64, *const c_char>` whose ok value
+// packs a byte buffer as ptr<<32|len, copies the buffer and frees it.
+func BytesResultRead(ctx context.Context, module api.Module, ptr int32) ([]byte, error) {
+	result, err := Result64Read(ctx, module, ptr)
+	if err != nil {
+		return nil, err
+	}
+	if result.ok {
+		respptr := uint32(result.data >> 32)
+		resplen := uint32(result.data)
+		defer MemoryFree(ctx, module, int32(respptr), int(resplen))
+		b, f := module.Memory().Read(respptr, resplen)
+		if !f {
+			return nil, ErrWasmReturnInvaild
+		}
+		var data = make([]byte, int(resplen), int(resplen))
+		copy(data, b)
+		return data, nil
+	}
+	error, err := CStrRead(ctx, module, int32(result.data))
+	if err != nil {
+		return nil, err
+	}
+	defer MemoryFree(ctx, module, int32(result.data), len(error)+1)
+	return nil, errors.New(error)
+}
+
 type Result32 struct {
 	ok   bool
 	data int32
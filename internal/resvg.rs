@@ -1,6 +1,13 @@
 use resvg::{usvg, tiny_skia};
-use usvg::{fontdb, TreeTextToPath, TreeParsing};
+use usvg::{fontdb, NodeExt, TreeTextToPath, TreeParsing};
+use std::alloc::{GlobalAlloc, Layout, System};
+use std::collections::{BTreeMap, HashMap};
 use std::ffi::{c_char, CStr, CString};
+use std::rc::Rc;
+use std::sync::Mutex;
+use std::sync::atomic::{AtomicU32, AtomicUsize, Ordering};
+use unicode_script::UnicodeScript;
+use serde::Serialize;
 
 #[repr(C)]
 pub enum Result<T, E> {
@@ -22,7 +29,41 @@ pub extern "C" fn fontdb_database_delete(database: *mut fontdb::Database) {
 #[no_mangle]
 pub extern "C" fn fontdb_database_load_font_data(database: &mut fontdb::Database, data_ptr: *mut u8, data_size: usize) {
     let data = unsafe { Vec::from_raw_parts(data_ptr, data_size, data_size) };
-    database.load_font_data(data);
+    database.load_font_source(fontdb::Source::Binary(std::sync::Arc::new(Blob::new(data))));
+}
+
+// Font data tagged with a blob ID, which unlike its address is never reused.
+struct Blob {
+    data: Vec<u8>,
+}
+
+static NEXT_BLOB: AtomicU32 = AtomicU32::new(1);
+
+// The blob IDs by the address of their data, removed when the data is freed.
+static BLOBS: Mutex<BTreeMap<usize, u32>> = Mutex::new(BTreeMap::new());
+
+impl Blob {
+    fn new(data: Vec<u8>) -> Blob {
+        let id = NEXT_BLOB.fetch_add(1, Ordering::Relaxed);
+        BLOBS.lock().unwrap().insert(data.as_ptr() as usize, id);
+        Blob { data }
+    }
+}
+
+impl AsRef<[u8]> for Blob {
+    fn as_ref(&self) -> &[u8] {
+        &self.data
+    }
+}
+
+impl Drop for Blob {
+    fn drop(&mut self) {
+        BLOBS.lock().unwrap().remove(&(self.data.as_ptr() as usize));
+    }
+}
+
+fn blob_id(data: &[u8]) -> Option<u32> {
+    BLOBS.lock().unwrap().get(&(data.as_ptr() as usize)).copied()
 }
 
 #[no_mangle]
@@ -56,6 +97,158 @@ pub extern "C" fn fontdb_database_len(database: &mut fontdb::Database) -> usize
     database.len()
 }
 
+#[derive(Serialize)]
+struct FaceInfo {
+    id: String,
+    families: Vec<FamilyNameInfo>,
+    post_script_name: String,
+    style: i32,
+    weight: u16,
+    stretch: u16,
+    monospaced: bool,
+    source: FaceSourceInfo,
+    index: u32,
+}
+
+#[derive(Serialize)]
+struct FamilyNameInfo {
+    name: String,
+    language: String,
+}
+
+#[derive(Serialize)]
+struct FaceSourceInfo {
+    path: Option<String>,
+    blob: Option<u32>,
+}
+
+fn face_info(face: &fontdb::FaceInfo) -> FaceInfo {
+    FaceInfo {
+        id: face.id.to_string(),
+        families: face.families.iter().map(|(name, language)| FamilyNameInfo {
+            name: name.clone(),
+            language: format!("{:?}", language),
+        }).collect(),
+        post_script_name: face.post_script_name.clone(),
+        style: match face.style {
+            fontdb::Style::Normal => 0,
+            fontdb::Style::Italic => 1,
+            fontdb::Style::Oblique => 2,
+        },
+        weight: face.weight.0,
+        stretch: face.stretch.to_number(),
+        monospaced: face.monospaced,
+        source: match face.source {
+            fontdb::Source::Binary(ref data) => FaceSourceInfo {
+                path: None,
+                blob: blob_id((**data).as_ref()),
+            },
+            fontdb::Source::File(ref path) | fontdb::Source::SharedFile(ref path, _) => FaceSourceInfo {
+                path: Some(path.to_string_lossy().into_owned()),
+                blob: None,
+            },
+        },
+        index: face.index,
+    }
+}
+
+#[no_mangle]
+pub extern "C" fn fontdb_database_faces(database: &fontdb::Database) -> Result<u64, *const c_char> {
+    let faces: Vec<FaceInfo> = database.faces().map(face_info).collect();
+    json_into_result(&faces)
+}
+
+#[no_mangle]
+pub extern "C" fn fontdb_database_query(database: &fontdb::Database, families: *const c_char, weight: u16, style: i32, stretch: u16) -> Result<u64, *const c_char> {
+    let families = unsafe { CStr::from_ptr(families) };
+    let families = match families.to_str() {
+        Ok(v) => v.to_owned(),
+        Err(e) => return Result::Err(CString::new(e.to_string()).unwrap().into_raw()),
+    };
+    let families: Vec<String> = match serde_json::from_str(&families) {
+        Ok(v) => v,
+        Err(e) => return Result::Err(CString::new(e.to_string()).unwrap().into_raw()),
+    };
+    let families: Vec<fontdb::Family> = families.iter().map(|f| family_from_name(f)).collect();
+    let style = match style {
+        1 => fontdb::Style::Italic,
+        2 => fontdb::Style::Oblique,
+        _ => fontdb::Style::Normal,
+    };
+    let stretch = match stretch {
+        1 => fontdb::Stretch::UltraCondensed,
+        2 => fontdb::Stretch::ExtraCondensed,
+        3 => fontdb::Stretch::Condensed,
+        4 => fontdb::Stretch::SemiCondensed,
+        6 => fontdb::Stretch::SemiExpanded,
+        7 => fontdb::Stretch::Expanded,
+        8 => fontdb::Stretch::ExtraExpanded,
+        9 => fontdb::Stretch::UltraExpanded,
+        _ => fontdb::Stretch::Normal,
+    };
+    let id = database.query(&fontdb::Query {
+        families: &families,
+        weight: fontdb::Weight(weight),
+        stretch,
+        style,
+    });
+    let face = id.and_then(|id| database.face(id)).map(face_info);
+    json_into_result(&face)
+}
+
+#[no_mangle]
+pub extern "C" fn fontdb_database_remove_face(database: &mut fontdb::Database, id: *const c_char) -> *const c_char {
+    let id = unsafe { CStr::from_ptr(id) };
+    let id = match id.to_str() {
+        Ok(v) => v.to_owned(),
+        Err(e) => return CString::new(e.to_string()).unwrap().into_raw(),
+    };
+    let face = match database.faces().find(|face| face.id.to_string() == id) {
+        Some(v) => v.id,
+        None => return CString::new(format!("face '{}' not found", id)).unwrap().into_raw(),
+    };
+    database.remove_face(face);
+    0 as *const c_char
+}
+
+#[no_mangle]
+pub extern "C" fn fontdb_database_remove_by_source(database: &mut fontdb::Database, path: *const c_char, blob: u32) -> usize {
+    let path = unsafe { CStr::from_ptr(path) };
+    let path = path.to_string_lossy().into_owned();
+    let ids: Vec<fontdb::ID> = database.faces().filter(|face| {
+        let source = face_info(face).source;
+        match source.path {
+            Some(v) => v == path,
+            None => source.blob == Some(blob),
+        }
+    }).map(|face| face.id).collect();
+    for id in ids.iter() {
+        database.remove_face(*id);
+    }
+    ids.len()
+}
+
+#[no_mangle]
+pub extern "C" fn fontdb_database_clear(database: &mut fontdb::Database) {
+    let ids: Vec<fontdb::ID> = database.faces().map(|face| face.id).collect();
+    for id in ids {
+        database.remove_face(id);
+    }
+}
+
+#[no_mangle]
+pub extern "C" fn fontdb_database_family_name(database: &fontdb::Database, generic: i32) -> Result<u64, *const c_char> {
+    let family = match generic {
+        0 => fontdb::Family::Serif,
+        1 => fontdb::Family::SansSerif,
+        2 => fontdb::Family::Cursive,
+        3 => fontdb::Family::Fantasy,
+        4 => fontdb::Family::Monospace,
+        _ => return Result::Err(CString::new("unknown generic family").unwrap().into_raw()),
+    };
+    Result::Ok(bytes_into_raw(database.family_name(&family).as_bytes().to_vec()))
+}
+
 #[no_mangle]
 pub extern "C" fn fontdb_database_set_serif_family(database: &mut fontdb::Database, family: *const c_char) -> *const c_char  {
     let family = unsafe { CStr::from_ptr(family) };
@@ -207,6 +400,12 @@ pub extern "C" fn usvg_options_set_default_size(options: &mut usvg::Options, wid
     options.default_size = size;
 }
 
+// Keeps `<image>` from loading files by path, only `data:` URLs are decoded.
+#[no_mangle]
+pub extern "C" fn usvg_options_block_external_images(options: &mut usvg::Options) {
+    options.image_href_resolver.resolve_string = Box::new(|_, _| None);
+}
+
 #[no_mangle]
 pub extern "C" fn tiny_skia_pixmap_new(width: u32, height: u32) -> Result<*mut tiny_skia::Pixmap, *const c_char> {
     let pixmap = match tiny_skia::Pixmap::new(width, height) {
@@ -253,6 +452,18 @@ pub extern "C" fn tiny_skia_pixmap_get_height(pixmap: &mut tiny_skia::Pixmap) ->
     pixmap.height()
 }
 
+#[no_mangle]
+pub extern "C" fn tiny_skia_pixmap_fill(pixmap: &mut tiny_skia::Pixmap, red: u8, green: u8, blue: u8, alpha: u8) {
+    pixmap.fill(tiny_skia::Color::from_rgba8(red, green, blue, alpha));
+}
+
+// Returns the premultiplied RGBA pixels as ptr<<32|len, they are still owned by the pixmap.
+#[no_mangle]
+pub extern "C" fn tiny_skia_pixmap_data(pixmap: &mut tiny_skia::Pixmap) -> u64 {
+    let data = pixmap.data_mut();
+    ((data.as_mut_ptr() as u64) << 32) | (data.len() as u64)
+}
+
 #[no_mangle]
 pub extern "C" fn tiny_skia_transform_identity() -> *mut tiny_skia::Transform {
     let transform = tiny_skia::Transform::identity();
@@ -305,21 +516,584 @@ pub extern "C" fn usvg_tree_from_data(data_ptr: *mut u8, data_size: usize, optio
     let data = unsafe { Vec::from_raw_parts(data_ptr, data_size, data_size) };
     let tree = match usvg::Tree::from_data(&data, options) {
         Ok(v) => v,
-        Err(e) => return Result::Err(CString::new(e.to_string()).unwrap().into_raw()),
+        Err(e) => return Result::Err(tree_error_into_raw(e)),
     };
     Result::Ok(Box::into_raw(tree.into()))
 }
 
+#[derive(Serialize)]
+struct TreeErrorInfo {
+    code: i32,
+    line: u32,
+    col: u32,
+    message: String,
+}
+
+// Returns the error as a JSON C string, the codes are mirrored by `TreeErrorRead` in Go.
+fn tree_error_into_raw(e: usvg::Error) -> *const c_char {
+    let mut info = TreeErrorInfo { code: 0, line: 0, col: 0, message: e.to_string() };
+    match e {
+        usvg::Error::NotAnUtf8Str => info.code = 1,
+        usvg::Error::MalformedGZip => info.code = 2,
+        usvg::Error::ElementsLimitReached => info.code = 3,
+        usvg::Error::InvalidSize => info.code = 4,
+        usvg::Error::ParsingFailed(e) => {
+            let pos = e.pos();
+            info.code = 5;
+            info.line = pos.row;
+            info.col = pos.col;
+            info.message = e.to_string();
+        }
+        #[allow(unreachable_patterns)]
+        _ => {}
+    }
+    CString::new(serde_json::to_string(&info).unwrap()).unwrap().into_raw()
+}
+
 #[no_mangle]
 pub extern "C" fn usvg_tree_delete(tree: *mut usvg::Tree) {
     let _ = unsafe { Box::from_raw(tree) };
 }
 
+#[no_mangle]
+pub extern "C" fn usvg_tree_clone(tree: &usvg::Tree) -> *mut usvg::Tree {
+    Box::into_raw(deep_copy_tree(tree).into())
+}
+
+// `Tree::clone` and `make_deep_copy` share the clip paths, masks and patterns,
+// which hold their own node trees, so they are copied too (once per `Rc`).
+// Filters are still shared, `feImage` nodes are never mutated by the wrapper.
+fn deep_copy_tree(tree: &usvg::Tree) -> usvg::Tree {
+    let root = tree.root.make_deep_copy();
+    SubrootCopier::default().copy_nodes(&root);
+    usvg::Tree {
+        size: tree.size,
+        view_box: tree.view_box,
+        root,
+    }
+}
+
+#[derive(Default)]
+struct SubrootCopier {
+    clip_paths: HashMap<*const usvg::ClipPath, Rc<usvg::ClipPath>>,
+    masks: HashMap<*const usvg::Mask, Rc<usvg::Mask>>,
+    patterns: HashMap<*const usvg::Pattern, Rc<usvg::Pattern>>,
+}
+
+impl SubrootCopier {
+    fn copy_nodes(&mut self, root: &usvg::Node) {
+        for mut node in root.descendants() {
+            match *node.borrow_mut() {
+                usvg::NodeKind::Group(ref mut group) => {
+                    if let Some(ref mut clip_path) = group.clip_path {
+                        *clip_path = self.clip_path(clip_path);
+                    }
+                    if let Some(ref mut mask) = group.mask {
+                        *mask = self.mask(mask);
+                    }
+                }
+                usvg::NodeKind::Path(ref mut path) => {
+                    if let Some(ref mut fill) = path.fill {
+                        self.paint(&mut fill.paint);
+                    }
+                    if let Some(ref mut stroke) = path.stroke {
+                        self.paint(&mut stroke.paint);
+                    }
+                }
+                usvg::NodeKind::Text(ref mut text) => {
+                    for span in text.chunks.iter_mut().flat_map(|c| c.spans.iter_mut()) {
+                        if let Some(ref mut fill) = span.fill {
+                            self.paint(&mut fill.paint);
+                        }
+                        if let Some(ref mut stroke) = span.stroke {
+                            self.paint(&mut stroke.paint);
+                        }
+                    }
+                }
+                _ => {}
+            }
+        }
+    }
+
+    fn paint(&mut self, paint: &mut usvg::Paint) {
+        if let usvg::Paint::Pattern(ref mut pattern) = paint {
+            *pattern = self.pattern(pattern);
+        }
+    }
+
+    fn clip_path(&mut self, clip_path: &Rc<usvg::ClipPath>) -> Rc<usvg::ClipPath> {
+        if let Some(copy) = self.clip_paths.get(&Rc::as_ptr(clip_path)) {
+            return copy.clone();
+        }
+        let copy = Rc::new(usvg::ClipPath {
+            id: clip_path.id.clone(),
+            units: clip_path.units,
+            transform: clip_path.transform,
+            clip_path: clip_path.clip_path.as_ref().map(|v| self.clip_path(v)),
+            root: clip_path.root.make_deep_copy(),
+        });
+        self.clip_paths.insert(Rc::as_ptr(clip_path), copy.clone());
+        self.copy_nodes(&copy.root);
+        copy
+    }
+
+    fn mask(&mut self, mask: &Rc<usvg::Mask>) -> Rc<usvg::Mask> {
+        if let Some(copy) = self.masks.get(&Rc::as_ptr(mask)) {
+            return copy.clone();
+        }
+        let copy = Rc::new(usvg::Mask {
+            id: mask.id.clone(),
+            units: mask.units,
+            content_units: mask.content_units,
+            rect: mask.rect,
+            kind: mask.kind,
+            mask: mask.mask.as_ref().map(|v| self.mask(v)),
+            root: mask.root.make_deep_copy(),
+        });
+        self.masks.insert(Rc::as_ptr(mask), copy.clone());
+        self.copy_nodes(&copy.root);
+        copy
+    }
+
+    fn pattern(&mut self, pattern: &Rc<usvg::Pattern>) -> Rc<usvg::Pattern> {
+        if let Some(copy) = self.patterns.get(&Rc::as_ptr(pattern)) {
+            return copy.clone();
+        }
+        let copy = Rc::new(usvg::Pattern {
+            id: pattern.id.clone(),
+            units: pattern.units,
+            content_units: pattern.content_units,
+            transform: pattern.transform,
+            rect: pattern.rect,
+            view_box: pattern.view_box,
+            root: pattern.root.make_deep_copy(),
+        });
+        self.patterns.insert(Rc::as_ptr(pattern), copy.clone());
+        self.copy_nodes(&copy.root);
+        copy
+    }
+}
+
+#[derive(Serialize, Default)]
+struct TextConversionReport {
+    fallback_families: Vec<FontFallbackInfo>,
+    missing_families: Vec<String>,
+    missing_glyphs: Vec<char>,
+}
+
+#[derive(Serialize, PartialEq)]
+struct FontFallbackInfo {
+    family: String,
+    fallback: String,
+}
+
+// Converts the text into paths and returns the fonts and glyphs usvg couldn't find,
+// in strict mode the text is left unconverted unless none is missing.
+#[no_mangle]
+pub extern "C" fn usvg_tree_convert_text_report(tree: &mut usvg::Tree, database: &mut fontdb::Database, strict: bool) -> Result<u64, *const c_char> {
+    let mut report = TextConversionReport::default();
+    for node in tree.root.descendants() {
+        if let usvg::NodeKind::Text(ref text) = *node.borrow() {
+            for chunk in text.chunks.iter() {
+                for span in chunk.spans.iter() {
+                    report_font(database, &span.font, &mut report);
+                    report_glyphs(database, &chunk.text, span, &mut report);
+                }
+            }
+        }
+    }
+    let mut copy = match strict {
+        true => Some(deep_copy_tree(tree)),
+        false => None,
+    };
+    match copy {
+        Some(ref mut copy) => copy.convert_text(database),
+        None => tree.convert_text(database),
+    }
+    let empty = report.fallback_families.is_empty() && report.missing_families.is_empty() && report.missing_glyphs.is_empty();
+    if let Some(copy) = copy {
+        if empty {
+            tree.root = copy.root;
+        }
+    }
+    json_into_result(&report)
+}
+
+// Reports the families of the font that usvg resolves to another family, or to none.
+fn report_font(database: &fontdb::Database, font: &usvg::Font, report: &mut TextConversionReport) {
+    let id = match resolve_font(database, font) {
+        Some(v) => v,
+        None => {
+            for family in font.families.iter() {
+                if !report.missing_families.contains(family) {
+                    report.missing_families.push(family.clone());
+                }
+            }
+            return;
+        }
+    };
+    let (requested, face) = match (font.families.first(), database.face(id)) {
+        (Some(requested), Some(face)) => (requested, face),
+        _ => return,
+    };
+    let name = match family_from_name(requested) {
+        fontdb::Family::Name(name) => name.to_owned(),
+        generic => database.family_name(&generic).to_owned(),
+    };
+    if face.families.iter().any(|(family, _)| *family == name) {
+        return;
+    }
+    let fallback = FontFallbackInfo {
+        family: requested.clone(),
+        fallback: face_family(face),
+    };
+    if !report.fallback_families.contains(&fallback) {
+        report.fallback_families.push(fallback);
+    }
+}
+
+// Reports the glyph fallbacks and the missing glyphs of the span the way usvg picks them
+// when shaping: a character missing from the resolved face is drawn with the first other face
+// of the database that has it, with the same style, weight or stretch.
+fn report_glyphs(database: &fontdb::Database, text: &str, span: &usvg::TextSpan, report: &mut TextConversionReport) {
+    let base = match resolve_font(database, &span.font).and_then(|id| database.face(id)) {
+        Some(v) => v,
+        None => return,
+    };
+    for c in text[span.start..span.end].chars() {
+        if c.is_control() || has_glyph(database, base.id, c) || report.missing_glyphs.contains(&c) {
+            continue;
+        }
+        let face = database.faces().find(|face| {
+            face.id != base.id
+                && !(face.style != base.style && face.weight != base.weight && face.stretch != base.stretch)
+                && has_glyph(database, face.id, c)
+        });
+        match face {
+            Some(face) => {
+                let fallback = FontFallbackInfo { family: face_family(base), fallback: face_family(face) };
+                if !report.fallback_families.contains(&fallback) {
+                    report.fallback_families.push(fallback);
+                }
+            }
+            None => report.missing_glyphs.push(c),
+        }
+    }
+}
+
+// The English family name of the face, usvg names the faces by it in its fallbacks.
+fn face_family(face: &fontdb::FaceInfo) -> String {
+    face.families.iter()
+        .find(|(_, language)| *language == fontdb::Language::English_UnitedStates)
+        .or(face.families.first())
+        .map(|(family, _)| family.clone())
+        .unwrap_or_default()
+}
+
+fn family_from_name(name: &str) -> fontdb::Family {
+    match name {
+        "serif" => fontdb::Family::Serif,
+        "sans-serif" => fontdb::Family::SansSerif,
+        "cursive" => fontdb::Family::Cursive,
+        "fantasy" => fontdb::Family::Fantasy,
+        "monospace" => fontdb::Family::Monospace,
+        name => fontdb::Family::Name(name),
+    }
+}
+
+fn query_font(database: &fontdb::Database, font: &usvg::Font, family: &str) -> Option<fontdb::ID> {
+    query_families(database, font, &[family_from_name(family)])
+}
+
+// Resolves the face of the font the way usvg does when converting text,
+// the `font-family` list followed by the serif family.
+fn resolve_font(database: &fontdb::Database, font: &usvg::Font) -> Option<fontdb::ID> {
+    let mut families: Vec<fontdb::Family> = font.families.iter().map(|f| family_from_name(f)).collect();
+    families.push(fontdb::Family::Serif);
+    query_families(database, font, &families)
+}
+
+fn query_families(database: &fontdb::Database, font: &usvg::Font, families: &[fontdb::Family]) -> Option<fontdb::ID> {
+    let style = match font.style {
+        usvg::FontStyle::Normal => fontdb::Style::Normal,
+        usvg::FontStyle::Italic => fontdb::Style::Italic,
+        usvg::FontStyle::Oblique => fontdb::Style::Oblique,
+    };
+    let stretch = match font.stretch {
+        usvg::FontStretch::UltraCondensed => fontdb::Stretch::UltraCondensed,
+        usvg::FontStretch::ExtraCondensed => fontdb::Stretch::ExtraCondensed,
+        usvg::FontStretch::Condensed => fontdb::Stretch::Condensed,
+        usvg::FontStretch::SemiCondensed => fontdb::Stretch::SemiCondensed,
+        usvg::FontStretch::Normal => fontdb::Stretch::Normal,
+        usvg::FontStretch::SemiExpanded => fontdb::Stretch::SemiExpanded,
+        usvg::FontStretch::Expanded => fontdb::Stretch::Expanded,
+        usvg::FontStretch::ExtraExpanded => fontdb::Stretch::ExtraExpanded,
+        usvg::FontStretch::UltraExpanded => fontdb::Stretch::UltraExpanded,
+    };
+    database.query(&fontdb::Query {
+        families,
+        weight: fontdb::Weight(font.weight),
+        stretch,
+        style,
+    })
+}
+
+// Splits the text spans so that the characters missing from the primary face of a span
+// are drawn with the first fallback family of their script (or "*") that has them.
+#[no_mangle]
+pub extern "C" fn usvg_tree_apply_font_fallback(tree: &mut usvg::Tree, database: &fontdb::Database, fallbacks: *const c_char) -> *const c_char {
+    let fallbacks = unsafe { CStr::from_ptr(fallbacks) };
+    let fallbacks: HashMap<String, Vec<String>> = match serde_json::from_slice(fallbacks.to_bytes()) {
+        Ok(v) => v,
+        Err(e) => return CString::new(e.to_string()).unwrap().into_raw(),
+    };
+    for mut node in tree.root.descendants() {
+        if let usvg::NodeKind::Text(ref mut text) = *node.borrow_mut() {
+            for chunk in text.chunks.iter_mut() {
+                let mut spans = Vec::new();
+                for span in chunk.spans.iter() {
+                    split_span_by_fallback(database, &fallbacks, &chunk.text, span, &mut spans);
+                }
+                chunk.spans = spans;
+            }
+        }
+    }
+    0 as *const c_char
+}
+
+fn split_span_by_fallback(database: &fontdb::Database, fallbacks: &HashMap<String, Vec<String>>, text: &str, span: &usvg::TextSpan, spans: &mut Vec<usvg::TextSpan>) {
+    let primary = span.font.families.iter().find_map(|family| query_font(database, &span.font, family));
+    // (start, fallback family) of the run being built, `None` keeps the span families.
+    let mut run: Option<(usize, Option<String>)> = None;
+    for (i, c) in text[span.start..span.end].char_indices() {
+        let i = span.start + i;
+        if run.is_some() && (c.is_control() || c.is_whitespace()) {
+            continue;
+        }
+        let family = match primary {
+            Some(id) if has_glyph(database, id, c) => None,
+            _ => fallback_family(database, fallbacks, &span.font, c),
+        };
+        match run {
+            Some((_, ref current)) if *current == family => {}
+            _ => {
+                if let Some((start, current)) = run.take() {
+                    spans.push(fallback_span(span, start, i, current));
+                }
+                run = Some((i, family));
+            }
+        }
+    }
+    match run {
+        Some((start, current)) => spans.push(fallback_span(span, start, span.end, current)),
+        None => spans.push(span.clone()),
+    }
+}
+
+fn fallback_family(database: &fontdb::Database, fallbacks: &HashMap<String, Vec<String>>, font: &usvg::Font, c: char) -> Option<String> {
+    let script = c.script().short_name();
+    let families = fallbacks.get(script).into_iter().chain(fallbacks.get("*")).flatten();
+    for family in families {
+        if let Some(id) = query_font(database, font, family) {
+            if has_glyph(database, id, c) {
+                return Some(family.clone());
+            }
+        }
+    }
+    None
+}
+
+fn fallback_span(span: &usvg::TextSpan, start: usize, end: usize, family: Option<String>) -> usvg::TextSpan {
+    let mut span = span.clone();
+    span.start = start;
+    span.end = end;
+    if let Some(family) = family {
+        span.font.families = vec![family];
+    }
+    span
+}
+
+fn has_glyph(database: &fontdb::Database, id: fontdb::ID, c: char) -> bool {
+    database.with_face_data(id, |data, index| {
+        ttf_parser::Face::parse(data, index).map(|face| face.glyph_index(c).is_some()).unwrap_or(false)
+    }).unwrap_or(false)
+}
+
 #[no_mangle]
 pub extern "C" fn usvg_tree_convert_text(tree: &mut usvg::Tree, database: &mut fontdb::Database) {
     tree.convert_text(database);
 }
 
+#[derive(Serialize)]
+struct TextInfo {
+    id: String,
+    content: String,
+    chunks: Vec<TextChunkInfo>,
+    glyphs: Option<Vec<GlyphInfo>>,
+}
+
+#[derive(Serialize)]
+struct TextChunkInfo {
+    x: Option<f32>,
+    y: Option<f32>,
+    content: String,
+    spans: Vec<TextSpanInfo>,
+}
+
+#[derive(Serialize)]
+struct TextSpanInfo {
+    content: String,
+    font_families: Vec<String>,
+    font_size: f32,
+}
+
+#[derive(Serialize)]
+struct GlyphInfo {
+    text: String,
+    bbox: Option<RectInfo>,
+}
+
+#[derive(Serialize)]
+struct RectInfo {
+    x: f32,
+    y: f32,
+    width: f32,
+    height: f32,
+}
+
+#[no_mangle]
+pub extern "C" fn usvg_tree_texts(tree: &usvg::Tree, database: Option<&fontdb::Database>) -> Result<u64, *const c_char> {
+    let mut texts: Vec<TextInfo> = Vec::new();
+    for node in tree.root.descendants() {
+        let text = match *node.borrow() {
+            usvg::NodeKind::Text(ref text) => text.clone(),
+            _ => continue,
+        };
+        let chunks: Vec<TextChunkInfo> = text.chunks.iter().map(|chunk| TextChunkInfo {
+            x: chunk.x,
+            y: chunk.y,
+            content: chunk.text.clone(),
+            spans: chunk.spans.iter().map(|span| TextSpanInfo {
+                content: chunk.text[span.start..span.end].to_owned(),
+                font_families: span.font.families.clone(),
+                font_size: span.font_size.get(),
+            }).collect(),
+        }).collect();
+        let glyphs = database.map(|database| text_glyphs(&node, &text, database));
+        texts.push(TextInfo {
+            id: text.id.clone(),
+            content: text.chunks.iter().map(|c| c.text.as_str()).collect(),
+            chunks,
+            glyphs,
+        });
+    }
+    json_into_result(&texts)
+}
+
+// Lays out the text like usvg, shaping each span once, and returns the bounding box
+// of the glyphs of every character, the characters of a cluster share its box.
+// Text on a path and vertical text aren't laid out, their boxes are `None`.
+fn text_glyphs(node: &usvg::Node, text: &usvg::Text, database: &fontdb::Database) -> Vec<GlyphInfo> {
+    let ts = node.abs_transform();
+    let mut glyphs = Vec::new();
+    let mut index = 0;
+    let (mut x, mut y) = (0.0, 0.0);
+    for chunk in text.chunks.iter() {
+        let chars: Vec<(usize, char)> = chunk.text.char_indices().collect();
+        let mut boxes: Vec<Option<tiny_skia::Rect>> = vec![None; chars.len()];
+        let linear = matches!(chunk.text_flow, usvg::TextFlow::Linear);
+        if linear && text.writing_mode == usvg::WritingMode::LeftToRight {
+            x = chunk.x.unwrap_or(x);
+            y = chunk.y.unwrap_or(y);
+            let start_x = x;
+            for span in chunk.spans.iter() {
+                let id = match resolve_font(database, &span.font) {
+                    Some(v) => v,
+                    None => continue,
+                };
+                database.with_face_data(id, |data, face_index| {
+                    let face = match rustybuzz::Face::from_slice(data, face_index) {
+                        Some(v) => v,
+                        None => return,
+                    };
+                    let scale = span.font_size.get() / face.units_per_em() as f32;
+                    let mut buffer = rustybuzz::UnicodeBuffer::new();
+                    buffer.push_str(&chunk.text[span.start..span.end]);
+                    buffer.guess_segment_properties();
+                    let output = rustybuzz::shape(&face, &[], buffer);
+                    // the clusters of the span, as indices of the first character of each in chars
+                    let mut clusters: Vec<usize> = output.glyph_infos().iter()
+                        .filter_map(|info| chars.binary_search_by_key(&(span.start + info.cluster as usize), |c| c.0).ok())
+                        .collect();
+                    clusters.sort_unstable();
+                    clusters.dedup();
+                    let mut moved = vec![false; chars.len()];
+                    for (info, pos) in output.glyph_infos().iter().zip(output.glyph_positions()) {
+                        let i = match chars.binary_search_by_key(&(span.start + info.cluster as usize), |c| c.0) {
+                            Ok(v) => v,
+                            Err(_) => continue,
+                        };
+                        if !moved[i] {
+                            moved[i] = true;
+                            if let Some(p) = text.positions.get(index + i) {
+                                x += p.dx.unwrap_or(0.0);
+                                y += p.dy.unwrap_or(0.0);
+                            }
+                        }
+                        let glyph = face.glyph_bounding_box(ttf_parser::GlyphId(info.glyph_id as u16));
+                        if let Some(r) = glyph {
+                            let rect = tiny_skia::Rect::from_ltrb(
+                                x + (pos.x_offset + r.x_min as i32) as f32 * scale,
+                                y - (pos.y_offset + r.y_max as i32) as f32 * scale,
+                                x + (pos.x_offset + r.x_max as i32) as f32 * scale,
+                                y - (pos.y_offset + r.y_min as i32) as f32 * scale,
+                            );
+                            boxes[i] = rect_union(boxes[i], rect);
+                        }
+                        x += pos.x_advance as f32 * scale + span.letter_spacing;
+                        if chars[i].1 == ' ' {
+                            x += span.word_spacing;
+                        }
+                    }
+                    // the other characters of a cluster take the box of its first character
+                    let mut cluster = clusters.iter().peekable();
+                    let mut first = None;
+                    for (i, (start, _)) in chars.iter().enumerate() {
+                        if *start < span.start || *start >= span.end {
+                            continue;
+                        }
+                        if cluster.peek() == Some(&&i) {
+                            first = cluster.next().copied();
+                        } else if let Some(first) = first {
+                            boxes[i] = boxes[first];
+                        }
+                    }
+                });
+            }
+            let shift = match chunk.anchor {
+                usvg::TextAnchor::Start => 0.0,
+                usvg::TextAnchor::Middle => (start_x - x) / 2.0,
+                usvg::TextAnchor::End => start_x - x,
+            };
+            for rect in boxes.iter_mut() {
+                *rect = rect.and_then(|r| r.translate(shift, 0.0));
+            }
+            x += shift;
+        }
+        for ((_, c), rect) in chars.iter().zip(boxes) {
+            let rect = rect
+                .and_then(|r| tiny_skia::PathBuilder::from_rect(r).transform(ts))
+                .map(|v| v.bounds());
+            glyphs.push(GlyphInfo {
+                text: c.to_string(),
+                bbox: rect.map(|r| RectInfo { x: r.x(), y: r.y(), width: r.width(), height: r.height() }),
+            });
+        }
+        index += chars.len();
+    }
+    glyphs
+}
+
 #[no_mangle]
 pub extern "C" fn usvg_tree_get_size_width(tree: &mut usvg::Tree) -> f32 {
     tree.size.width()
@@ -330,6 +1104,320 @@ pub extern "C" fn usvg_tree_get_size_height(tree: &mut usvg::Tree) -> f32 {
     tree.size.height()
 }
 
+#[no_mangle]
+pub extern "C" fn usvg_tree_hit_test(tree: &usvg::Tree, transform: &mut tiny_skia::Transform, x: f32, y: f32) -> Result<u64, *const c_char> {
+    let mut ids: Vec<String> = Vec::new();
+    for node in tree.root.descendants() {
+        let path = match *node.borrow() {
+            usvg::NodeKind::Path(ref path) => path.clone(),
+            _ => continue,
+        };
+        if path.visibility != usvg::Visibility::Visible {
+            continue;
+        }
+        let ts = transform.pre_concat(node.abs_transform());
+        if !path_contains_point(&path, ts, x, y) {
+            continue;
+        }
+        if let Some(id) = node.ancestors().map(|n| n.id().to_string()).find(|id| !id.is_empty()) {
+            if !ids.contains(&id) {
+                ids.push(id);
+            }
+        }
+    }
+    // Topmost element first.
+    ids.reverse();
+    json_into_result(&ids)
+}
+
+fn path_contains_point(path: &usvg::Path, transform: tiny_skia::Transform, x: f32, y: f32) -> bool {
+    let mut mask = match tiny_skia::Mask::new(1, 1) {
+        Some(v) => v,
+        None => return false,
+    };
+    // Move the point to the center of the single mask pixel.
+    let ts = transform.post_translate(0.5 - x, 0.5 - y);
+    if let Some(ref fill) = path.fill {
+        let rule = match fill.rule {
+            usvg::FillRule::NonZero => tiny_skia::FillRule::Winding,
+            usvg::FillRule::EvenOdd => tiny_skia::FillRule::EvenOdd,
+        };
+        mask.fill_path(&path.data, rule, false, ts);
+    }
+    if let Some(ref stroke) = path.stroke {
+        if let Some(outline) = path.data.stroke(&tiny_skia_stroke(stroke), 1.0) {
+            mask.fill_path(&outline, tiny_skia::FillRule::Winding, false, ts);
+        }
+    }
+    mask.data()[0] != 0
+}
+
+fn tiny_skia_stroke(stroke: &usvg::Stroke) -> tiny_skia::Stroke {
+    tiny_skia::Stroke {
+        width: stroke.width.get(),
+        miter_limit: stroke.miterlimit.get(),
+        line_cap: match stroke.linecap {
+            usvg::LineCap::Butt => tiny_skia::LineCap::Butt,
+            usvg::LineCap::Round => tiny_skia::LineCap::Round,
+            usvg::LineCap::Square => tiny_skia::LineCap::Square,
+        },
+        line_join: match stroke.linejoin {
+            usvg::LineJoin::Miter => tiny_skia::LineJoin::Miter,
+            usvg::LineJoin::MiterClip => tiny_skia::LineJoin::MiterClip,
+            usvg::LineJoin::Round => tiny_skia::LineJoin::Round,
+            usvg::LineJoin::Bevel => tiny_skia::LineJoin::Bevel,
+        },
+        dash: stroke.dasharray.as_ref().and_then(|v| tiny_skia::StrokeDash::new(v.clone(), stroke.dashoffset)),
+    }
+}
+
+// Returns the bounding box of the node in canvas coordinates, strokes included.
+#[no_mangle]
+pub extern "C" fn usvg_tree_node_bbox(tree: &usvg::Tree, id: *const c_char) -> Result<u64, *const c_char> {
+    let id = unsafe { CStr::from_ptr(id) };
+    let id = match id.to_str() {
+        Ok(v) => v.to_owned(),
+        Err(e) => return Result::Err(CString::new(e.to_string()).unwrap().into_raw()),
+    };
+    let node = match tree.node_by_id(&id) {
+        Some(v) => v,
+        None => return Result::Err(CString::new(format!("node '{}' not found", id)).unwrap().into_raw()),
+    };
+    let mut bbox: Option<tiny_skia::Rect> = None;
+    for node in node.descendants() {
+        let ts = node.abs_transform();
+        match *node.borrow() {
+            usvg::NodeKind::Path(ref path) => {
+                let rect = path.data.as_ref().clone().transform(ts).map(|v| v.bounds());
+                bbox = rect_union(bbox, rect);
+                if let Some(ref stroke) = path.stroke {
+                    let rect = path.data.stroke(&tiny_skia_stroke(stroke), 1.0)
+                        .and_then(|v| v.transform(ts))
+                        .map(|v| v.bounds());
+                    bbox = rect_union(bbox, rect);
+                }
+            }
+            usvg::NodeKind::Image(ref image) => {
+                let r = image.view_box.rect;
+                let rect = tiny_skia::Rect::from_xywh(r.x(), r.y(), r.width(), r.height())
+                    .and_then(|v| tiny_skia::PathBuilder::from_rect(v).transform(ts))
+                    .map(|v| v.bounds());
+                bbox = rect_union(bbox, rect);
+            }
+            _ => {}
+        }
+    }
+    match bbox {
+        Some(r) => json_into_result(&RectInfo { x: r.x(), y: r.y(), width: r.width(), height: r.height() }),
+        None => Result::Err(CString::new(format!("node '{}' has no bounding box", id)).unwrap().into_raw()),
+    }
+}
+
+fn rect_union(a: Option<tiny_skia::Rect>, b: Option<tiny_skia::Rect>) -> Option<tiny_skia::Rect> {
+    match (a, b) {
+        (Some(a), Some(b)) => tiny_skia::Rect::from_ltrb(
+            a.left().min(b.left()),
+            a.top().min(b.top()),
+            a.right().max(b.right()),
+            a.bottom().max(b.bottom()),
+        ),
+        (a, None) => a,
+        (None, b) => b,
+    }
+}
+
+// Removes all the nodes but the node, its ancestors and descendants.
+#[no_mangle]
+pub extern "C" fn usvg_tree_retain_node(tree: &mut usvg::Tree, id: *const c_char) -> *const c_char {
+    let id = unsafe { CStr::from_ptr(id) };
+    let id = match id.to_str() {
+        Ok(v) => v.to_owned(),
+        Err(e) => return CString::new(e.to_string()).unwrap().into_raw(),
+    };
+    let mut current = match tree.node_by_id(&id) {
+        Some(v) => v,
+        None => return CString::new(format!("node '{}' not found", id)).unwrap().into_raw(),
+    };
+    while let Some(parent) = current.parent() {
+        let siblings: Vec<usvg::Node> = parent.children().filter(|c| *c != current).collect();
+        for mut sibling in siblings {
+            sibling.detach();
+        }
+        current = parent;
+    }
+    0 as *const c_char
+}
+
+#[no_mangle]
+pub extern "C" fn usvg_tree_set_fill(tree: &mut usvg::Tree, id: *const c_char, red: u8, green: u8, blue: u8) -> *const c_char {
+    let id = unsafe { CStr::from_ptr(id) };
+    let id = match id.to_str() {
+        Ok(v) => v.to_owned(),
+        Err(e) => return CString::new(e.to_string()).unwrap().into_raw(),
+    };
+    let node = match tree.node_by_id(&id) {
+        Some(v) => v,
+        None => return CString::new(format!("node '{}' not found", id)).unwrap().into_raw(),
+    };
+    let paint = usvg::Paint::Color(usvg::Color::new_rgb(red, green, blue));
+    for mut node in node.descendants() {
+        match *node.borrow_mut() {
+            usvg::NodeKind::Path(ref mut path) => {
+                let mut fill = path.fill.take().unwrap_or_default();
+                fill.paint = paint.clone();
+                path.fill = Some(fill);
+            }
+            usvg::NodeKind::Text(ref mut text) => {
+                for span in text.chunks.iter_mut().flat_map(|c| c.spans.iter_mut()) {
+                    let mut fill = span.fill.take().unwrap_or_default();
+                    fill.paint = paint.clone();
+                    span.fill = Some(fill);
+                }
+            }
+            _ => {}
+        }
+    }
+    0 as *const c_char
+}
+
+#[no_mangle]
+pub extern "C" fn usvg_tree_set_stroke(tree: &mut usvg::Tree, id: *const c_char, red: u8, green: u8, blue: u8, width: f32) -> *const c_char {
+    let id = unsafe { CStr::from_ptr(id) };
+    let id = match id.to_str() {
+        Ok(v) => v.to_owned(),
+        Err(e) => return CString::new(e.to_string()).unwrap().into_raw(),
+    };
+    let node = match tree.node_by_id(&id) {
+        Some(v) => v,
+        None => return CString::new(format!("node '{}' not found", id)).unwrap().into_raw(),
+    };
+    let width = match usvg::NonZeroPositiveF32::new(width) {
+        Some(v) => v,
+        None => return CString::new("stroke width must be positive").unwrap().into_raw(),
+    };
+    let paint = usvg::Paint::Color(usvg::Color::new_rgb(red, green, blue));
+    for mut node in node.descendants() {
+        match *node.borrow_mut() {
+            usvg::NodeKind::Path(ref mut path) => {
+                let mut stroke = path.stroke.take().unwrap_or_default();
+                stroke.paint = paint.clone();
+                stroke.width = width;
+                path.stroke = Some(stroke);
+            }
+            usvg::NodeKind::Text(ref mut text) => {
+                for span in text.chunks.iter_mut().flat_map(|c| c.spans.iter_mut()) {
+                    let mut stroke = span.stroke.take().unwrap_or_default();
+                    stroke.paint = paint.clone();
+                    stroke.width = width;
+                    span.stroke = Some(stroke);
+                }
+            }
+            _ => {}
+        }
+    }
+    0 as *const c_char
+}
+
+#[no_mangle]
+pub extern "C" fn usvg_tree_set_opacity(tree: &mut usvg::Tree, id: *const c_char, opacity: f32) -> *const c_char {
+    let id = unsafe { CStr::from_ptr(id) };
+    let id = match id.to_str() {
+        Ok(v) => v.to_owned(),
+        Err(e) => return CString::new(e.to_string()).unwrap().into_raw(),
+    };
+    let mut node = match tree.node_by_id(&id) {
+        Some(v) => v,
+        None => return CString::new(format!("node '{}' not found", id)).unwrap().into_raw(),
+    };
+    let opacity = usvg::Opacity::new_clamped(opacity);
+    match *node.borrow_mut() {
+        usvg::NodeKind::Group(ref mut group) => group.opacity = opacity,
+        usvg::NodeKind::Path(ref mut path) => {
+            if let Some(ref mut fill) = path.fill {
+                fill.opacity = opacity;
+            }
+            if let Some(ref mut stroke) = path.stroke {
+                stroke.opacity = opacity;
+            }
+        }
+        usvg::NodeKind::Text(ref mut text) => {
+            for span in text.chunks.iter_mut().flat_map(|c| c.spans.iter_mut()) {
+                if let Some(ref mut fill) = span.fill {
+                    fill.opacity = opacity;
+                }
+                if let Some(ref mut stroke) = span.stroke {
+                    stroke.opacity = opacity;
+                }
+            }
+        }
+        usvg::NodeKind::Image(_) => return CString::new(format!("node '{}' is an image", id)).unwrap().into_raw(),
+    }
+    0 as *const c_char
+}
+
+#[no_mangle]
+pub extern "C" fn usvg_tree_set_visible(tree: &mut usvg::Tree, id: *const c_char, visible: bool) -> *const c_char {
+    let id = unsafe { CStr::from_ptr(id) };
+    let id = match id.to_str() {
+        Ok(v) => v.to_owned(),
+        Err(e) => return CString::new(e.to_string()).unwrap().into_raw(),
+    };
+    let node = match tree.node_by_id(&id) {
+        Some(v) => v,
+        None => return CString::new(format!("node '{}' not found", id)).unwrap().into_raw(),
+    };
+    let visibility = if visible { usvg::Visibility::Visible } else { usvg::Visibility::Hidden };
+    for mut node in node.descendants() {
+        match *node.borrow_mut() {
+            usvg::NodeKind::Path(ref mut path) => path.visibility = visibility,
+            usvg::NodeKind::Image(ref mut image) => image.visibility = visibility,
+            usvg::NodeKind::Text(ref mut text) => {
+                for span in text.chunks.iter_mut().flat_map(|c| c.spans.iter_mut()) {
+                    span.visibility = visibility;
+                }
+            }
+            _ => {}
+        }
+    }
+    0 as *const c_char
+}
+
+#[no_mangle]
+pub extern "C" fn usvg_tree_replace_color(tree: &mut usvg::Tree, from_red: u8, from_green: u8, from_blue: u8, to_red: u8, to_green: u8, to_blue: u8) {
+    let from = usvg::Color::new_rgb(from_red, from_green, from_blue);
+    let to = usvg::Color::new_rgb(to_red, to_green, to_blue);
+    let replace = |paint: &mut usvg::Paint| {
+        if let usvg::Paint::Color(ref mut color) = paint {
+            if *color == from {
+                *color = to;
+            }
+        }
+    };
+    for mut node in tree.root.descendants() {
+        match *node.borrow_mut() {
+            usvg::NodeKind::Path(ref mut path) => {
+                if let Some(ref mut fill) = path.fill {
+                    replace(&mut fill.paint);
+                }
+                if let Some(ref mut stroke) = path.stroke {
+                    replace(&mut stroke.paint);
+                }
+            }
+            usvg::NodeKind::Text(ref mut text) => {
+                for span in text.chunks.iter_mut().flat_map(|c| c.spans.iter_mut()) {
+                    if let Some(ref mut fill) = span.fill {
+                        replace(&mut fill.paint);
+                    }
+                    if let Some(ref mut stroke) = span.stroke {
+                        replace(&mut stroke.paint);
+                    }
+                }
+            }
+            _ => {}
+        }
+    }
+}
+
 #[no_mangle]
 pub extern "C" fn resvg_tree_from_usvg(tree: &usvg::Tree) -> *mut resvg::Tree {
     let rtree = resvg::Tree::from_usvg(tree);
@@ -360,4 +1448,73 @@ pub extern "C" fn memory_malloc(size: usize) -> *mut u8 {
 #[no_mangle]
 pub extern "C" fn memory_free(data_ptr: *mut u8, data_size: usize) {
     let _ = unsafe { Vec::from_raw_parts(data_ptr, 0, data_size) };
-}
\ No newline at end of file
+}
+
+// Counts the heap bytes in use and their peak for `memory_heap_stats`.
+struct CountingAllocator;
+
+static HEAP_IN_USE: AtomicUsize = AtomicUsize::new(0);
+static HEAP_PEAK: AtomicUsize = AtomicUsize::new(0);
+
+fn heap_grow(size: usize) {
+    let used = HEAP_IN_USE.fetch_add(size, Ordering::Relaxed) + size;
+    HEAP_PEAK.fetch_max(used, Ordering::Relaxed);
+}
+
+unsafe impl GlobalAlloc for CountingAllocator {
+    unsafe fn alloc(&self, layout: Layout) -> *mut u8 {
+        let ptr = System.alloc(layout);
+        if !ptr.is_null() {
+            heap_grow(layout.size());
+        }
+        ptr
+    }
+
+    unsafe fn alloc_zeroed(&self, layout: Layout) -> *mut u8 {
+        let ptr = System.alloc_zeroed(layout);
+        if !ptr.is_null() {
+            heap_grow(layout.size());
+        }
+        ptr
+    }
+
+    unsafe fn dealloc(&self, ptr: *mut u8, layout: Layout) {
+        System.dealloc(ptr, layout);
+        HEAP_IN_USE.fetch_sub(layout.size(), Ordering::Relaxed);
+    }
+
+    unsafe fn realloc(&self, ptr: *mut u8, layout: Layout, new_size: usize) -> *mut u8 {
+        let new_ptr = System.realloc(ptr, layout, new_size);
+        if !new_ptr.is_null() {
+            HEAP_IN_USE.fetch_sub(layout.size(), Ordering::Relaxed);
+            heap_grow(new_size);
+        }
+        new_ptr
+    }
+}
+
+#[global_allocator]
+static GLOBAL: CountingAllocator = CountingAllocator;
+
+// Returns the heap bytes in use and their peak as in_use<<32|peak.
+#[no_mangle]
+pub extern "C" fn memory_heap_stats() -> u64 {
+    let in_use = HEAP_IN_USE.load(Ordering::Relaxed) as u64;
+    let peak = HEAP_PEAK.load(Ordering::Relaxed) as u64;
+    (in_use << 32) | (peak & 0xffff_ffff)
+}
+
+fn bytes_into_raw(mut data: Vec<u8>) -> u64 {
+    data.shrink_to_fit();
+    let ptr = data.as_mut_ptr();
+    let size = data.len();
+    std::mem::forget(data);
+    ((ptr as u64) << 32) | (size as u64)
+}
+
+fn json_into_result<T: Serialize>(value: &T) -> Result<u64, *const c_char> {
+    match serde_json::to_vec(value) {
+        Ok(v) => Result::Ok(bytes_into_raw(v)),
+        Err(e) => Result::Err(CString::new(e.to_string()).unwrap().into_raw()),
+    }
+}
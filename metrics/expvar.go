@@ -0,0 +1,104 @@
+// Package metrics exports the operations of resvg workers as expvar variables,
+// such as to be scraped by Prometheus through an expvar collector.
+//
+//	worker, _ := resvg.NewDefaultWorker(ctx, resvg.WithObserver(metrics.NewExpvar("resvg")))
+package metrics
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"time"
+
+	resvg "github.com/kanrichan/resvg-go"
+)
+
+// DurationBuckets the upper bounds of the duration histograms.
+var DurationBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// Expvar a `resvg.Observer` publishing per operation in an expvar map:
+//   - `<op>.count` the number of operations
+//   - `<op>.duration_ns` the total duration
+//   - `<op>.duration_le_<bucket>` the cumulative duration histogram
+//   - `<op>.bytes_in` and `<op>.bytes_out` the total bytes
+//   - `<op>.errors.<type>` the number of errors by `ErrorType`
+//
+// `Expvar` is goroutine-safe and can be shared by many workers.
+type Expvar struct {
+	vars *expvar.Map
+}
+
+// NewExpvar publishes the expvar map of the name,
+// it panics if the name is already published like `expvar.NewMap`.
+func NewExpvar(name string) *Expvar {
+	return &Expvar{expvar.NewMap(name)}
+}
+
+// Map returns the published expvar map.
+func (e *Expvar) Map() *expvar.Map {
+	return e.vars
+}
+
+// Start implements `resvg.Observer`.
+func (e *Expvar) Start(ctx context.Context, op resvg.Operation) context.Context {
+	return ctx
+}
+
+// End implements `resvg.Observer`.
+func (e *Expvar) End(ctx context.Context, event resvg.Event) {
+	prefix := string(event.Operation) + "."
+	e.vars.Add(prefix+"count", 1)
+	e.vars.Add(prefix+"duration_ns", int64(event.Duration))
+	for _, bucket := range DurationBuckets {
+		if event.Duration <= bucket {
+			e.vars.Add(prefix+"duration_le_"+bucket.String(), 1)
+		}
+	}
+	e.vars.Add(prefix+"bytes_in", int64(event.BytesIn))
+	e.vars.Add(prefix+"bytes_out", int64(event.BytesOut))
+	if event.Err != nil {
+		e.vars.Add(prefix+"errors."+ErrorType(event.Err), 1)
+	}
+}
+
+// ErrorType returns a short name of the type of a resvg error for labels,
+// "other" for the errors resvg doesn't define.
+func ErrorType(err error) string {
+	var perr *resvg.ParseError
+	var terr *resvg.TextConversionError
+	switch {
+	case errors.Is(err, resvg.ErrWorkerIsBeingUsed):
+		return "worker_is_being_used"
+	case errors.Is(err, resvg.ErrWorkerClosed):
+		return "worker_closed"
+	case errors.Is(err, resvg.ErrWorkerMismatch):
+		return "worker_mismatch"
+	case errors.Is(err, resvg.ErrClosed):
+		return "closed"
+	case errors.Is(err, resvg.ErrNotUTF8):
+		return "not_utf8"
+	case errors.Is(err, resvg.ErrMalformedGZip):
+		return "malformed_gzip"
+	case errors.Is(err, resvg.ErrElementsLimitReached):
+		return "elements_limit_reached"
+	case errors.Is(err, resvg.ErrInvalidSize):
+		return "invalid_size"
+	case errors.Is(err, resvg.ErrEmptySize):
+		return "empty_size"
+	case errors.As(err, &perr):
+		return "parse"
+	case errors.As(err, &terr):
+		return "text_conversion"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"context"
+	"expvar"
+	"testing"
+
+	resvg "github.com/kanrichan/resvg-go"
+)
+
+func TestExpvar(t *testing.T) {
+	var svg = []byte(
+		`<svg width="100" height="100" xmlns="http://www.w3.org/2000/svg">
+			<rect x="10" y="10" width="80" height="80" fill="black"/>
+		</svg>`)
+	observer := NewExpvar("resvg_test")
+	worker, err := resvg.NewDefaultWorker(context.Background(), resvg.WithObserver(observer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	data, err := worker.Render(svg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = worker.NewTreeFromData([]byte("<svg"), &resvg.Options{})
+	if err == nil {
+		t.Fatal("parsing must fail")
+	}
+	vars := observer.Map()
+	if vars.Get("Render.count").(*expvar.Int).Value() != 1 {
+		t.Fatal("render must be counted")
+	}
+	if vars.Get("Render.bytes_in").(*expvar.Int).Value() != int64(len(svg)) {
+		t.Fatal("illegal bytes in")
+	}
+	if vars.Get("Render.bytes_out").(*expvar.Int).Value() != int64(len(data)) {
+		t.Fatal("illegal bytes out")
+	}
+	if vars.Get("NewTreeFromData.errors."+ErrorType(err)) == nil {
+		t.Fatal("error must be counted")
+	}
+}
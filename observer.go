@@ -0,0 +1,61 @@
+package resvg
+
+import (
+	"context"
+	"time"
+)
+
+// Operation an operation of a `Worker` reported to its `Observer`.
+type Operation string
+
+const (
+	OperationNewTreeFromData Operation = "NewTreeFromData"
+	OperationConvertText     Operation = "ConvertText"
+	OperationRender          Operation = "Render"
+	OperationEncodePNG       Operation = "EncodePNG"
+)
+
+// Event the result of an operation.
+type Event struct {
+	Operation Operation
+	Duration  time.Duration
+	// BytesIn the bytes of the input, such as the SVG data.
+	BytesIn int
+	// BytesOut the bytes of the output, such as the rendered pixels or the PNG data.
+	BytesOut int
+	Err      error
+}
+
+// Observer instruments the operations of a `Worker`, see `WithObserver`.
+// An OpenTelemetry span per operation can be made by starting it in `Start`
+// with a tracer and ending it in `End` with `trace.SpanFromContext`.
+type Observer interface {
+	// Start is called when an operation starts with the context of the `Worker`,
+	// the returned context is passed to `End`.
+	Start(ctx context.Context, op Operation) context.Context
+	// End is called when the operation ends.
+	End(ctx context.Context, event Event)
+}
+
+// WorkerOption configures a `Worker`.
+type WorkerOption func(wk *Worker)
+
+// WithObserver reports the operations of the `Worker` to the observer.
+func WithObserver(observer Observer) WorkerOption {
+	return func(wk *Worker) {
+		wk.observer = observer
+	}
+}
+
+// observe starts the operation for the observer of the `Worker`,
+// the returned function ends it.
+func (wk *Worker) observe(op Operation, bytesIn int) func(bytesOut int, err error) {
+	if wk.observer == nil {
+		return func(int, error) {}
+	}
+	start := time.Now()
+	ctx := wk.observer.Start(wk.ctx, op)
+	return func(bytesOut int, err error) {
+		wk.observer.End(ctx, Event{op, time.Since(start), bytesIn, bytesOut, err})
+	}
+}
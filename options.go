@@ -9,9 +9,12 @@ type TextRenderingMode int32
 // ImageRenderingMode an image rendering method, `image-rendering` attribute in the SVG.
 type ImageRenderingMode int32
 
+// The zero modes keep the defaults, so that every mode can be set.
 const (
+	// ShapeRenderingModeDefault GeometricPrecision
+	ShapeRenderingModeDefault ShapeRenderingMode = iota
 	// ShapeRenderingModeOptimizeSpeed OptimizeSpeed
-	ShapeRenderingModeOptimizeSpeed ShapeRenderingMode = iota
+	ShapeRenderingModeOptimizeSpeed
 	// ShapeRenderingModeCrispEdges CrispEdges
 	ShapeRenderingModeCrispEdges
 	// ShapeRenderingModeGeometricPrecision GeometricPrecision
@@ -19,8 +22,10 @@ const (
 )
 
 const (
+	// TextRenderingModeDefault OptimizeLegibility
+	TextRenderingModeDefault TextRenderingMode = iota
 	// TextRenderingModeOptimizeSpeed OptimizeSpeed
-	TextRenderingModeOptimizeSpeed TextRenderingMode = iota
+	TextRenderingModeOptimizeSpeed
 	// TextRenderingModeOptimizeLegibility OptimizeLegibility
 	TextRenderingModeOptimizeLegibility
 	// TextRenderingModeGeometricPrecision GeometricPrecision
@@ -28,8 +33,10 @@ const (
 )
 
 const (
+	// ImageRenderingModeDefault OptimizeQuality
+	ImageRenderingModeDefault ImageRenderingMode = iota
 	// ImageRenderingModeOptimizeQuality OptimizeQuality
-	ImageRenderingModeOptimizeQuality ImageRenderingMode = iota
+	ImageRenderingModeOptimizeQuality
 	// ImageRenderingModeOptimizeSpeed OptimizeSpeed
 	ImageRenderingModeOptimizeSpeed
 )
@@ -86,4 +93,16 @@ type Options struct {
 	// the `height` attributes are relative.
 	// Default: `100`
 	DefaultSizeHeight float32
+
+	// CurrentColor the color of `currentColor`, like the CSS `color` of an `<img>`
+	// in HTML, such as to render an icon in the colors of a theme.
+	// It is set as the `color` of the root element unless the SVG sets one.
+	// Default: black
+	CurrentColor *Color
+
+	// BlockExternalImages keeps `<image>` from loading the files of its `href`,
+	// only `data:` URLs are decoded. Set it to render untrusted SVGs, whose
+	// absolute paths and `..` could read any file the worker can open.
+	// Default: false
+	BlockExternalImages bool
 }
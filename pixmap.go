@@ -1,66 +1,159 @@
 package resvg
 
-import "github.com/kanrichan/resvg-go/internal"
+import (
+	"image"
+	"runtime"
+
+	"github.com/kanrichan/resvg-go/internal"
+)
 
 // Pixmap tinyskia pixmap
 type Pixmap struct {
 	wk  *Worker
 	ptr int32
+	// size the bytes of the pixels.
+	size int64
 }
 
 // NewPixmap allocates a new `Pixmap`.
 // Pixmap's width is limited by int32::MAX/4.
 // `Pixmap` are not goroutine-safe, don't forget to close!
 func (wk *Worker) NewPixmap(width uint32, height uint32) (*Pixmap, error) {
-	if !wk.used.CompareAndSwap(false, true) {
-		return nil, ErrWorkerIsBeingUsed
+	if err := wk.acquire(); err != nil {
+		return nil, err
 	}
-	defer wk.used.Store(false)
+	defer wk.release()
 	pm, err := internal.TinySkiaPixmapNew(wk.ctx, wk.mod, width, height)
 	if err != nil {
 		return nil, err
 	}
-	return &Pixmap{wk, pm}, nil
+	pixmap := &Pixmap{wk: wk, ptr: pm, size: int64(width) * int64(height) * 4}
+	wk.track(handlePixmap, pixmap.size)
+	runtime.SetFinalizer(pixmap, (*Pixmap).finalize)
+	return pixmap, nil
 }
 
 // NewPixmapDecodePNG decodes a PNG data  into a `Pixmap`.
 func (wk *Worker) NewPixmapDecodePNG(data []byte) (*Pixmap, error) {
-	if !wk.used.CompareAndSwap(false, true) {
-		return nil, ErrWorkerIsBeingUsed
+	if err := wk.acquire(); err != nil {
+		return nil, err
 	}
-	defer wk.used.Store(false)
+	defer wk.release()
 	pm, err := internal.TinySkiaPixmapDecodePNG(wk.ctx, wk.mod, data)
 	if err != nil {
 		return nil, err
 	}
-	return &Pixmap{wk, pm}, nil
+	width, err := internal.TinySkiaPixmapGetWidth(wk.ctx, wk.mod, pm)
+	if err != nil {
+		internal.TinySkiaPixmapDelete(wk.ctx, wk.mod, pm)
+		return nil, err
+	}
+	height, err := internal.TinySkiaPixmapGetHeight(wk.ctx, wk.mod, pm)
+	if err != nil {
+		internal.TinySkiaPixmapDelete(wk.ctx, wk.mod, pm)
+		return nil, err
+	}
+	pixmap := &Pixmap{wk: wk, ptr: pm, size: int64(width) * int64(height) * 4}
+	wk.track(handlePixmap, pixmap.size)
+	runtime.SetFinalizer(pixmap, (*Pixmap).finalize)
+	return pixmap, nil
 }
 
 // Close cloes the `Pixmap` and recovers memory.
 func (pm *Pixmap) Close() error {
-	if !pm.wk.used.CompareAndSwap(false, true) {
-		return ErrWorkerIsBeingUsed
+	if err := pm.wk.acquire(); err != nil {
+		return err
 	}
-	defer pm.wk.used.Store(false)
+	defer pm.wk.release()
 	if pm.ptr == 0 {
-		return ErrPointerIsNil
+		return ErrClosed
 	}
 	err := internal.TinySkiaPixmapDelete(pm.wk.ctx, pm.wk.mod, pm.ptr)
 	if err != nil {
 		return err
 	}
 	pm.ptr = 0
+	pm.wk.untrack(handlePixmap, pm.size)
+	runtime.SetFinalizer(pm, nil)
 	return nil
 }
 
+// finalize queues the wasm memory of a `Pixmap` that was not closed to be freed.
+func (pm *Pixmap) finalize() {
+	pm.wk.finalize(handlePixmap, pm.ptr, pm.size)
+}
+
 // EncodePNG encodes pixmap into a PNG data.
-func (pm *Pixmap) EncodePNG() ([]byte, error) {
-	if !pm.wk.used.CompareAndSwap(false, true) {
-		return nil, ErrWorkerIsBeingUsed
+func (pm *Pixmap) EncodePNG() (data []byte, err error) {
+	end := pm.wk.observe(OperationEncodePNG, int(pm.size))
+	defer func() { end(len(data), err) }()
+	if err := pm.wk.acquire(); err != nil {
+		return nil, err
 	}
-	defer pm.wk.used.Store(false)
+	defer pm.wk.release()
 	if pm.ptr == 0 {
-		return nil, ErrPointerIsNil
+		return nil, ErrClosed
 	}
 	return internal.TinySkiaPixmapEncodePng(pm.wk.ctx, pm.wk.mod, pm.ptr)
 }
+
+// GetSize returns Pixmap's width and height.
+func (pm *Pixmap) GetSize() (uint32, uint32, error) {
+	if err := pm.wk.acquire(); err != nil {
+		return 0, 0, err
+	}
+	defer pm.wk.release()
+	if pm.ptr == 0 {
+		return 0, 0, ErrClosed
+	}
+	width, err := internal.TinySkiaPixmapGetWidth(pm.wk.ctx, pm.wk.mod, pm.ptr)
+	if err != nil {
+		return 0, 0, err
+	}
+	height, err := internal.TinySkiaPixmapGetHeight(pm.wk.ctx, pm.wk.mod, pm.ptr)
+	if err != nil {
+		return 0, 0, err
+	}
+	return width, height, nil
+}
+
+// Fill fills the whole pixmap with the color of the alpha.
+func (pm *Pixmap) Fill(color Color, alpha uint8) error {
+	if err := pm.wk.acquire(); err != nil {
+		return err
+	}
+	defer pm.wk.release()
+	if pm.ptr == 0 {
+		return ErrClosed
+	}
+	return internal.TinySkiaPixmapFill(pm.wk.ctx, pm.wk.mod, pm.ptr, color.Red, color.Green, color.Blue, alpha)
+}
+
+// Image copies the pixels into an `image.RGBA`, which is alpha-premultiplied like the pixmap,
+// such as to be encoded by other encoders than `EncodePNG`.
+func (pm *Pixmap) Image() (*image.RGBA, error) {
+	if err := pm.wk.acquire(); err != nil {
+		return nil, err
+	}
+	defer pm.wk.release()
+	if pm.ptr == 0 {
+		return nil, ErrClosed
+	}
+	width, err := internal.TinySkiaPixmapGetWidth(pm.wk.ctx, pm.wk.mod, pm.ptr)
+	if err != nil {
+		return nil, err
+	}
+	height, err := internal.TinySkiaPixmapGetHeight(pm.wk.ctx, pm.wk.mod, pm.ptr)
+	if err != nil {
+		return nil, err
+	}
+	data, err := internal.TinySkiaPixmapData(pm.wk.ctx, pm.wk.mod, pm.ptr)
+	if err != nil {
+		return nil, err
+	}
+	return &image.RGBA{
+		Pix:    data,
+		Stride: int(width) * 4,
+		Rect:   image.Rect(0, 0, int(width), int(height)),
+	}, nil
+}
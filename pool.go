@@ -0,0 +1,153 @@
+package resvg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"runtime"
+	"sync"
+)
+
+// PoolOptions the options of a `Pool`.
+type PoolOptions struct {
+	// Size the number of workers.
+	// Default: `runtime.NumCPU()`
+	Size int
+
+	// Fonts are synced into the `FontDB` of a worker before each use,
+	// so fonts added to the registry later are picked up.
+	Fonts *FontRegistry
+
+	// LoadFonts called once for the `FontDB` of each worker, such as to set its families,
+	// prefer `Fonts` for the fonts, which are read once for all the workers.
+	LoadFonts func(db *FontDB) error
+
+	// WorkerOptions the options of each worker.
+	WorkerOptions []WorkerOption
+}
+
+// Pool a fixed set of workers shared by goroutines,
+// each worker with its own `FontDB`.
+// `Pool` are goroutine-safe, don't forget to close!
+type Pool struct {
+	opts PoolOptions
+	// fonts the fingerprint of the `FontDB`s after `LoadFonts`.
+	fonts string
+	idle  chan *pooled
+	all   []*pooled
+	done  chan struct{}
+	once  sync.Once
+}
+
+// pooled a worker of a pool.
+type pooled struct {
+	wk     *Worker
+	fontdb *FontDB
+}
+
+// NewPool new a pool and start its workers.
+func NewPool(ctx context.Context, opts PoolOptions) (*Pool, error) {
+	if opts.Size <= 0 {
+		opts.Size = runtime.NumCPU()
+	}
+	p := &Pool{
+		opts: opts,
+		idle: make(chan *pooled, opts.Size),
+		done: make(chan struct{}),
+	}
+	for i := 0; i < opts.Size; i++ {
+		pw, err := p.start(ctx)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.all = append(p.all, pw)
+		p.idle <- pw
+	}
+	p.fonts = p.all[0].fontdb.Fingerprint()
+	return p, nil
+}
+
+func (p *Pool) start(ctx context.Context) (*pooled, error) {
+	wk, err := NewDefaultWorker(ctx, p.opts.WorkerOptions...)
+	if err != nil {
+		return nil, err
+	}
+	fontdb, err := wk.NewFontDBDefault()
+	if err != nil {
+		wk.Close()
+		return nil, err
+	}
+	if p.opts.LoadFonts != nil {
+		err = p.opts.LoadFonts(fontdb)
+		if err != nil {
+			wk.Close()
+			return nil, err
+		}
+	}
+	return &pooled{wk: wk, fontdb: fontdb}, nil
+}
+
+// Size returns the number of workers.
+func (p *Pool) Size() int {
+	return p.opts.Size
+}
+
+// Do waits for an idle worker and calls fn with it and its `FontDB`.
+// The worker and the `FontDB` must not be used after fn returns.
+func (p *Pool) Do(ctx context.Context, fn func(wk *Worker, fontdb *FontDB) error) error {
+	select {
+	case <-p.done:
+		return ErrPoolClosed
+	default:
+	}
+	var pw *pooled
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.done:
+		return ErrPoolClosed
+	case pw = <-p.idle:
+	}
+	defer func() { p.idle <- pw }()
+	if p.opts.Fonts != nil {
+		err := p.opts.Fonts.Sync(pw.fontdb)
+		if err != nil {
+			return err
+		}
+	}
+	return fn(pw.wk, pw.fontdb)
+}
+
+// FontFingerprint returns a hash of the fonts the workers render with,
+// from the `FontDB` loaded by `LoadFonts` and the `Fonts` registry.
+// See `FontDB.Fingerprint`.
+func (p *Pool) FontFingerprint() string {
+	if p.opts.Fonts == nil {
+		return p.fonts
+	}
+	sum := sha256.Sum256([]byte(p.fonts + p.opts.Fonts.Fingerprint()))
+	return hex.EncodeToString(sum[:])
+}
+
+// Stats returns the statistics of each worker.
+func (p *Pool) Stats() []WorkerStats {
+	stats := make([]WorkerStats, len(p.all))
+	for i, pw := range p.all {
+		stats[i] = pw.wk.Stats()
+	}
+	return stats
+}
+
+// Close waits for the workers in use and closes all of them.
+func (p *Pool) Close() error {
+	p.once.Do(func() {
+		close(p.done)
+		for range p.all {
+			pw := <-p.idle
+			pw.fontdb.Close()
+			pw.wk.Close()
+		}
+	})
+	return nil
+}
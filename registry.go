@@ -0,0 +1,229 @@
+package resvg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// ErrNoBundledFonts is returned by `FontDB.LoadBundled` when no fonts were registered,
+// import `github.com/kanrichan/resvg-go/fonts` to bundle them.
+var ErrNoBundledFonts = errors.New("no bundled fonts registered")
+
+// bundled the fonts registered by `RegisterBundledFonts`.
+var bundled struct {
+	mu        sync.Mutex
+	registry  *FontRegistry
+	fallbacks map[string][]string
+}
+
+// GenericFamilies the families used by the generic font families,
+// empty ones are left unchanged.
+type GenericFamilies struct {
+	Serif     string
+	SansSerif string
+	Cursive   string
+	Fantasy   string
+	Monospace string
+}
+
+// FontRegistry fonts loaded once in Go and shared by the `FontDB`s of many workers.
+// Fonts are replicated lazily into each `FontDB` by `Sync`.
+// `FontRegistry` are goroutine-safe.
+type FontRegistry struct {
+	mu       sync.Mutex
+	fonts    [][]byte
+	families GenericFamilies
+	// generation increases every time the families are changed.
+	generation int
+	// sums folds the hashes of the fonts, see `Fingerprint`.
+	sums [sha256.Size]byte
+}
+
+// registrySync what a `FontRegistry` has replicated into a `FontDB`.
+type registrySync struct {
+	fonts      int
+	generation int
+}
+
+// NewFontRegistry creates an empty `FontRegistry`.
+func NewFontRegistry() *FontRegistry {
+	return &FontRegistry{}
+}
+
+// AddFontData adds font data to the registry.
+// The data must not be modified afterwards.
+func (r *FontRegistry) AddFontData(data []byte) {
+	sum := sha256.Sum256(data)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fonts = append(r.fonts, data)
+	r.sums = sha256.Sum256(append(r.sums[:], sum[:]...))
+}
+
+// AddFontFile reads a font file into the registry.
+func (r *FontRegistry) AddFontFile(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	r.AddFontData(data)
+	return nil
+}
+
+// AddFontsFS reads font files (ttf, otf, ttc and otc) from the root directory
+// of the fsys recursively into the registry.
+func (r *FontRegistry) AddFontsFS(fsys fs.FS, root string) error {
+	return fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(path.Ext(name)) {
+		case ".ttf", ".otf", ".ttc", ".otc":
+		default:
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		r.AddFontData(data)
+		return nil
+	})
+}
+
+// SetGenericFamilies sets the families used by the generic font families.
+func (r *FontRegistry) SetGenericFamilies(families GenericFamilies) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families = families
+	r.generation++
+}
+
+// Fingerprint returns a hash of the fonts and the families of the registry,
+// such as to key the rendered images in a cache.
+func (r *FontRegistry) Fingerprint() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h := sha256.New()
+	h.Write(r.sums[:])
+	for _, family := range []string{r.families.Serif, r.families.SansSerif, r.families.Cursive, r.families.Fantasy, r.families.Monospace} {
+		h.Write([]byte(family))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Len returns the number of fonts in the registry.
+func (r *FontRegistry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.fonts)
+}
+
+// NewFontDB new a `FontDB` in the worker with the fonts of the registry.
+// `FontDB` are not goroutine-safe, don't forget to close!
+func (r *FontRegistry) NewFontDB(wk *Worker) (*FontDB, error) {
+	db, err := wk.NewFontDBDefault()
+	if err != nil {
+		return nil, err
+	}
+	err = r.Sync(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Sync loads the fonts and families the `FontDB` doesn't have yet,
+// all of them again after `FontDB.Clear`, but not the faces removed one by one.
+func (r *FontRegistry) Sync(db *FontDB) error {
+	r.mu.Lock()
+	fonts := r.fonts
+	families := r.families
+	generation := r.generation
+	r.mu.Unlock()
+	if db.synced == nil {
+		db.synced = make(map[*FontRegistry]registrySync)
+	}
+	state := db.synced[r]
+	defer func() { db.synced[r] = state }()
+	for ; state.fonts < len(fonts); state.fonts++ {
+		err := db.LoadFontData(fonts[state.fonts])
+		if err != nil {
+			return err
+		}
+	}
+	if state.generation == generation {
+		return nil
+	}
+	for _, f := range []struct {
+		family string
+		set    func(string) error
+	}{
+		{families.Serif, db.SetSerifFamily},
+		{families.SansSerif, db.SetSansSerifFamily},
+		{families.Cursive, db.SetCursiveFamily},
+		{families.Fantasy, db.SetFantasyFamily},
+		{families.Monospace, db.SetMonospaceFamily},
+	} {
+		if f.family == "" {
+			continue
+		}
+		err := f.set(f.family)
+		if err != nil {
+			return err
+		}
+	}
+	state.generation = generation
+	return nil
+}
+
+// RegisterBundledFonts registers the font files of the fsys, the families and the
+// fallback families by script loaded by `FontDB.LoadBundled`,
+// it is called by the init of the `fonts` package.
+func RegisterBundledFonts(fsys fs.FS, families GenericFamilies, fallbacks map[string][]string) error {
+	registry := NewFontRegistry()
+	err := registry.AddFontsFS(fsys, ".")
+	if err != nil {
+		return err
+	}
+	registry.SetGenericFamilies(families)
+	bundled.mu.Lock()
+	defer bundled.mu.Unlock()
+	bundled.registry = registry
+	bundled.fallbacks = fallbacks
+	return nil
+}
+
+// LoadBundled loads the bundled fonts and sets the generic families
+// and the fallback families of their scripts accordingly.
+func (db *FontDB) LoadBundled() error {
+	bundled.mu.Lock()
+	registry := bundled.registry
+	fallbacks := bundled.fallbacks
+	bundled.mu.Unlock()
+	if registry == nil {
+		return ErrNoBundledFonts
+	}
+	err := registry.Sync(db)
+	if err != nil {
+		return err
+	}
+	for script, families := range fallbacks {
+		err = db.SetFallbackFamilies(script, families)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Package rendercache caches the images rendered from SVGs by the hash of the SVG,
+// the options, the fonts and the output parameters, and renders the concurrent
+// identical requests once, such as for `httprender`.
+//
+//	r := rendercache.NewRenderer(rendercache.NewMemoryCache(256 << 20))
+//	key := rendercache.Key(svg, options, pool.FontFingerprint(), params)
+//	data, err := r.Render(ctx, key, func() ([]byte, error) {
+//		// render the SVG with a worker of the pool
+//	})
+package rendercache
+
+import (
+	"container/list"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Cache stores the rendered images by key, the hash of the SVG, the options,
+// the fonts and the output parameters, see `Key`. Caches must be goroutine-safe
+// and must not modify the data.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, data []byte)
+}
+
+// MemoryCache an in-memory LRU `Cache` limited in bytes.
+type MemoryCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	lru      *list.List
+	entries  map[string]*list.Element
+}
+
+// memoryEntry an element of the lru.
+type memoryEntry struct {
+	key  string
+	data []byte
+}
+
+// NewMemoryCache new a cache of at most maxBytes of images,
+// the least recently used images are evicted first.
+func NewMemoryCache(maxBytes int64) *MemoryCache {
+	return &MemoryCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*memoryEntry).data, true
+}
+
+// Set stores the image, images larger than the cache are not stored.
+func (c *MemoryCache) Set(key string, data []byte) {
+	if int64(len(data)) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.size += int64(len(data) - len(e.Value.(*memoryEntry).data))
+		e.Value.(*memoryEntry).data = data
+		c.lru.MoveToFront(e)
+	} else {
+		c.entries[key] = c.lru.PushFront(&memoryEntry{key, data})
+		c.size += int64(len(data))
+	}
+	for c.size > c.maxBytes {
+		e := c.lru.Back()
+		entry := e.Value.(*memoryEntry)
+		c.lru.Remove(e)
+		delete(c.entries, entry.key)
+		c.size -= int64(len(entry.data))
+	}
+}
+
+// Len returns the number of images in the cache.
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Size returns the bytes of the images in the cache.
+func (c *MemoryCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// FSCache a `Cache` of files in a directory, which survives restarts
+// and can be shared by processes. Nothing is evicted, old files can be
+// pruned by their modification time.
+type FSCache struct {
+	dir string
+}
+
+// NewFSCache new a cache of files in the dir.
+func NewFSCache(dir string) *FSCache {
+	return &FSCache{dir: dir}
+}
+
+// path returns the file of the key, spread over subdirectories by its prefix.
+func (c *FSCache) path(key string) string {
+	if len(key) < 4 {
+		return filepath.Join(c.dir, key)
+	}
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+func (c *FSCache) Get(key string) ([]byte, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// Set stores the image, errors are ignored as the image is rendered again.
+func (c *FSCache) Set(key string, data []byte) {
+	path := c.path(key)
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return
+	}
+	// write aside and rename, so that readers never see a partial file
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
@@ -0,0 +1,101 @@
+package rendercache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryCache(t *testing.T) {
+	c := NewMemoryCache(10)
+	c.Set("a", []byte("aaaa"))
+	c.Set("b", []byte("bbbb"))
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a must be cached")
+	}
+	// b is the least recently used
+	c.Set("c", []byte("cccc"))
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("b must be evicted")
+	}
+	if c.Len() != 2 || c.Size() != 8 {
+		t.Fatal("unexpected len and size", c.Len(), c.Size())
+	}
+	c.Set("d", []byte("too large to be cached"))
+	if _, ok := c.Get("d"); ok || c.Len() != 2 {
+		t.Fatal("d must not be cached")
+	}
+	c.Set("a", []byte("a"))
+	if data, _ := c.Get("a"); string(data) != "a" || c.Size() != 5 {
+		t.Fatal("a must be replaced")
+	}
+}
+
+func TestFSCache(t *testing.T) {
+	c := NewFSCache(t.TempDir())
+	if _, ok := c.Get("0123456789abcdef"); ok {
+		t.Fatal("cache must be empty")
+	}
+	c.Set("0123456789abcdef", []byte("png"))
+	data, ok := c.Get("0123456789abcdef")
+	if !ok || !bytes.Equal(data, []byte("png")) {
+		t.Fatal("data must be cached")
+	}
+}
+
+func TestRenderer(t *testing.T) {
+	r := NewRenderer(NewMemoryCache(1 << 10))
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func() ([]byte, error) {
+		calls.Add(1)
+		<-release
+		return []byte("png"), nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := r.Render(context.Background(), "key", fn)
+			if err != nil || string(data) != "png" {
+				t.Error("unexpected data", data, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls.Load() != 1 {
+		t.Fatal("fn must be called once not", calls.Load())
+	}
+	data, err := r.Render(context.Background(), "key", func() ([]byte, error) { return nil, errors.New("not cached") })
+	if err != nil || string(data) != "png" {
+		t.Fatal("the output must be cached", data, err)
+	}
+	block := make(chan struct{})
+	defer close(block)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = r.Render(ctx, "other", func() ([]byte, error) {
+		<-block
+		return []byte("jpeg"), nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal("the render must be canceled with the ctx", err)
+	}
+}
+
+func TestKey(t *testing.T) {
+	svg := []byte("<svg/>")
+	if Key(svg, nil, "", 1) != Key(svg, nil, "", 1) {
+		t.Fatal("the same inputs must have the same key")
+	}
+	if Key(svg, nil, "", 1) == Key(svg, nil, "fonts", 1) || Key(svg, nil, "", 1) == Key(svg, nil, "", 2) {
+		t.Fatal("different inputs must have different keys")
+	}
+}
@@ -0,0 +1,96 @@
+package rendercache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	resvg "github.com/kanrichan/resvg-go"
+)
+
+// Key returns the key of the SVG rendered with the options, the fonts,
+// such as `Pool.FontFingerprint`, and the output params marshaled as JSON.
+func Key(svg []byte, options *resvg.Options, fonts string, params any) string {
+	h := sha256.New()
+	h.Write(svg)
+	data, _ := json.Marshal(struct {
+		Options *resvg.Options
+		Fonts   string
+		Params  any
+	}{options, fonts, params})
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// Renderer returns the outputs of the `Cache`, or renders them once
+// for the concurrent identical keys and stores them.
+type Renderer struct {
+	cache   Cache
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight a rendering shared by the concurrent identical calls.
+type flight struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// NewRenderer new a renderer storing in the cache,
+// nil only deduplicates the concurrent renderings.
+func NewRenderer(cache Cache) *Renderer {
+	return &Renderer{cache: cache}
+}
+
+// Cache returns the `Cache` of the renderer, or nil.
+func (r *Renderer) Cache() Cache {
+	return r.cache
+}
+
+// Render returns the output of the key from the cache, or the output of fn,
+// waiting for it within the ctx. fn is run in a new goroutine unless the key
+// is already in flight, it is not canceled with the ctx so that the other
+// calls and the cache get its output, successful outputs are stored.
+func (r *Renderer) Render(ctx context.Context, key string, fn func() ([]byte, error)) ([]byte, error) {
+	if r.cache != nil {
+		if data, ok := r.cache.Get(key); ok {
+			return data, nil
+		}
+	}
+	f := r.start(key, fn)
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-f.done:
+		return f.data, f.err
+	}
+}
+
+// start returns the flight of the key, fn is run in a new goroutine
+// unless the key is already in flight.
+func (r *Renderer) start(key string, fn func() ([]byte, error)) *flight {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.flights[key]; ok {
+		return f
+	}
+	if r.flights == nil {
+		r.flights = make(map[string]*flight)
+	}
+	f := &flight{done: make(chan struct{})}
+	r.flights[key] = f
+	go func() {
+		f.data, f.err = fn()
+		if f.err == nil && r.cache != nil {
+			r.cache.Set(key, f.data)
+		}
+		r.mu.Lock()
+		delete(r.flights, key)
+		r.mu.Unlock()
+		close(f.done)
+	}()
+	return f
+}
@@ -10,15 +10,39 @@ import (
 
 var (
 	ErrWorkerIsBeingUsed = errors.New("worker is being used")
-	ErrPointerIsNil      = errors.New("pointer is nil")
+	// ErrPointerIsNil is no longer returned, see `ErrClosed`.
+	ErrPointerIsNil = errors.New("pointer is nil")
+	// ErrClosed returned when a `Tree`, `Pixmap` or `FontDB` is used after `Close`.
+	ErrClosed = errors.New("handle is closed")
+	// ErrWorkerMismatch returned when handles of different `Worker`s are used together.
+	ErrWorkerMismatch = errors.New("handles belong to different workers")
+	// ErrWorkerClosed returned when the `Worker` of a handle is closed.
+	ErrWorkerClosed = errors.New("worker is closed")
+	// ErrPoolClosed returned when a `Pool` is used after `Close`.
+	ErrPoolClosed = errors.New("pool is closed")
+	// ErrEmptySize returned when an SVG is fitted into an image of no pixels.
+	ErrEmptySize = errors.New("image has an empty size")
 )
 
+// Errors returned by `NewTreeFromData` when the SVG data can't be parsed.
+var (
+	ErrNotUTF8              = internal.ErrNotUTF8
+	ErrMalformedGZip        = internal.ErrMalformedGZip
+	ErrElementsLimitReached = internal.ErrElementsLimitReached
+	ErrInvalidSize          = internal.ErrInvalidSize
+)
+
+// ParseError returned by `NewTreeFromData` when the SVG data is not a valid XML.
+type ParseError = internal.ParseError
+
 // Render render the SVG as a PNG by default
-func (wk *Worker) Render(svg []byte) ([]byte, error) {
-	if !wk.used.CompareAndSwap(false, true) {
-		return nil, ErrWorkerIsBeingUsed
+func (wk *Worker) Render(svg []byte) (data []byte, err error) {
+	end := wk.observe(OperationRender, len(svg))
+	defer func() { end(len(data), err) }()
+	if err := wk.acquire(); err != nil {
+		return nil, err
 	}
-	defer wk.used.Store(false)
+	defer wk.release()
 	options, err := internal.UsvgOptionsDefault(wk.ctx, wk.mod)
 	if err != nil {
 		return nil, err
@@ -52,7 +76,9 @@ func (wk *Worker) Render(svg []byte) ([]byte, error) {
 		return nil, err
 	}
 	defer internal.TinySkiaTransformDelete(wk.ctx, wk.mod, transform)
+	wk.stats.renders.Add(1)
 	err = internal.ResvgTreeRender(wk.ctx, wk.mod, rtree, transform, pixmap)
+	wk.readHeapStats()
 	if err != nil {
 		return nil, err
 	}
@@ -1,9 +1,21 @@
 package resvg
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/fs"
+	"math"
 	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/kanrichan/resvg-go/internal"
 )
@@ -24,6 +36,24 @@ func TestMemory(t *testing.T) {
 	}
 }
 
+func TestWasmExports(t *testing.T) {
+	ctx := context.Background()
+	worker, err := NewDefaultWorker(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	var missing []string
+	for _, name := range internal.ExportNames {
+		if worker.mod.ExportedFunction(name) == nil {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) != 0 {
+		t.Fatalf("resvg.wasm.gz is stale, run go generate: missing %d exports %v", len(missing), missing)
+	}
+}
+
 func TestFontDB(t *testing.T) {
 	ctx := context.Background()
 	worker, err := NewDefaultWorker(ctx)
@@ -126,7 +156,7 @@ func TestTree(t *testing.T) {
 		t.Fatal(err)
 	}
 	defer fontdb.Close()
-	err = tree.ConvertText(fontdb)
+	_, err = tree.ConvertText(fontdb)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -170,3 +200,1333 @@ func TestRender(t *testing.T) {
 		t.Fatal("illegal PNG")
 	}
 }
+
+func TestMisuse(t *testing.T) {
+	var svg = []byte(
+		`<svg width="100" height="100" xmlns="http://www.w3.org/2000/svg">
+			<rect x="10" y="10" width="80" height="80" fill="black"/>
+		</svg>`)
+	worker1, err := NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker1.Close()
+	worker2, err := NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := worker1.NewTreeFromData(svg, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pixmap, err := worker2.NewPixmap(100, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tree.Render(TransformIdentity(), pixmap)
+	if !errors.Is(err, ErrWorkerMismatch) {
+		t.Fatal("must be ErrWorkerMismatch, got", err)
+	}
+	err = tree.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = tree.GetSize()
+	if !errors.Is(err, ErrClosed) {
+		t.Fatal("must be ErrClosed, got", err)
+	}
+	err = worker2.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = pixmap.EncodePNG()
+	if !errors.Is(err, ErrWorkerClosed) {
+		t.Fatal("must be ErrWorkerClosed, got", err)
+	}
+	err = worker2.Close()
+	if !errors.Is(err, ErrWorkerClosed) {
+		t.Fatal("must be ErrWorkerClosed, got", err)
+	}
+}
+
+func TestFinalizer(t *testing.T) {
+	worker, err := NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	_, err = worker.NewPixmap(100, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10 && worker.Stats().Finalized == 0; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats := worker.Stats()
+	if stats.Finalized != 1 || stats.PendingFrees != 1 {
+		t.Fatal("pixmap must be finalized, got", stats)
+	}
+	pixmap, err := worker.NewPixmap(100, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pixmap.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats = worker.Stats()
+	if stats.Finalized != 1 || stats.PendingFrees != 0 {
+		t.Fatal("finalized pixmap must be freed, got", stats)
+	}
+}
+
+func TestWorkerStats(t *testing.T) {
+	var svg = []byte(
+		`<svg width="100" height="100" xmlns="http://www.w3.org/2000/svg">
+			<rect x="10" y="10" width="80" height="80" fill="black"/>
+		</svg>`)
+	worker, err := NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	tree, err := worker.NewTreeFromData(svg, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pixmap, err := worker.NewPixmap(100, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fontdb, err := worker.NewFontDBDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fontdb.LoadFontFile("./testdata/arial.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat("./testdata/arial.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tree.Render(TransformIdentity(), pixmap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := worker.Stats()
+	if stats.Trees != 1 || stats.Pixmaps != 1 || stats.FontDBs != 1 {
+		t.Fatal("illegal live handles", stats)
+	}
+	if stats.PixmapBytes != 100*100*4 || stats.FontBytes != info.Size() {
+		t.Fatal("illegal held bytes", stats)
+	}
+	if stats.Renders != 1 || stats.MemorySize == 0 || stats.WasmTime == 0 {
+		t.Fatal("illegal stats", stats)
+	}
+	if stats.HeapErr != nil {
+		t.Fatal(stats.HeapErr)
+	}
+	if stats.HeapInUse == 0 || stats.HeapPeak < stats.HeapInUse {
+		t.Fatal("illegal heap stats", stats)
+	}
+	for _, c := range []interface{ Close() error }{tree, pixmap, fontdb} {
+		err = c.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats = worker.Stats()
+	if stats.Trees != 0 || stats.Pixmaps != 0 || stats.FontDBs != 0 || stats.PixmapBytes != 0 || stats.FontBytes != 0 {
+		t.Fatal("closed handles must not be counted", stats)
+	}
+}
+
+func TestTreeParseError(t *testing.T) {
+	worker, err := NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	_, err = worker.NewTreeFromData([]byte{0xff, 0xfe, 0xfd}, &Options{})
+	if !errors.Is(err, ErrNotUTF8) {
+		t.Fatal("must be ErrNotUTF8, got", err)
+	}
+	_, err = worker.NewTreeFromData([]byte{0x1f, 0x8b, 0x00}, &Options{})
+	if !errors.Is(err, ErrMalformedGZip) {
+		t.Fatal("must be ErrMalformedGZip, got", err)
+	}
+	_, err = worker.NewTreeFromData([]byte(`<svg xmlns="http://www.w3.org/2000/svg" width="0" height="0"/>`), &Options{})
+	if !errors.Is(err, ErrInvalidSize) {
+		t.Fatal("must be ErrInvalidSize, got", err)
+	}
+	_, err = worker.NewTreeFromData([]byte("<svg xmlns=\"http://www.w3.org/2000/svg\">\n  <rect></svg>"), &Options{})
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatal("must be *ParseError, got", err)
+	}
+	if perr.Line != 2 {
+		t.Fatal("parse error must be at line 2, got", perr.Line)
+	}
+}
+
+func TestHitTest(t *testing.T) {
+	var svg = []byte(
+		`<svg width="100" height="100" xmlns="http://www.w3.org/2000/svg">
+			<rect id="rect1" x="10" y="10" width="80" height="80" fill="black"/>
+			<circle id="circle1" cx="50" cy="50" r="5" fill="none" stroke="red" stroke-width="2"/>
+		</svg>`)
+	worker, err := NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	tree, err := worker.NewTreeFromData(svg, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	ids, err := tree.HitTest(45, 50, TransformIdentity())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != "circle1" || ids[1] != "rect1" {
+		t.Fatal("hit test must be [circle1 rect1], got", ids)
+	}
+	ids, err = tree.HitTest(5, 5, TransformIdentity())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 {
+		t.Fatal("hit test must be empty, got", ids)
+	}
+	ids, err = tree.HitTest(30, 30, TransformFromScale(0.5, 0.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != "rect1" {
+		t.Fatal("hit test must be [rect1], got", ids)
+	}
+}
+
+func TestTreeMutation(t *testing.T) {
+	var svg = []byte(
+		`<svg width="100" height="100" xmlns="http://www.w3.org/2000/svg">
+			<rect id="rect1" x="0" y="0" width="50" height="100" fill="black"/>
+			<rect id="rect2" x="50" y="0" width="50" height="100" fill="red"/>
+		</svg>`)
+	worker, err := NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	tree, err := worker.NewTreeFromData(svg, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	err = tree.ReplaceColor(Color{0, 0, 0}, Color{0, 0, 255})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tree.SetFill("rect2", Color{0, 255, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tree.SetStroke("rect2", Color{0, 0, 0}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tree.SetOpacity("rect2", 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tree.SetVisible("rect1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tree.ReplaceColor(Color{0, 255, 0}, Color{255, 255, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tree.SetFill("missing", Color{})
+	if err == nil {
+		t.Fatal("set fill of missing node must fail")
+	}
+	pixmap, err := worker.NewPixmap(100, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pixmap.Close()
+	err = tree.Render(TransformIdentity(), pixmap)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCurrentColor(t *testing.T) {
+	worker, err := NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	for _, c := range []struct {
+		svg  string
+		want color.RGBA
+	}{
+		{`<?xml version="1.0" encoding="iso-8859-1"?>
+			<!-- currentColor -->
+			<svg width="2" height="1" xmlns="http://www.w3.org/2000/svg">
+				<rect width="1" height="1" fill="currentColor"/>
+				<rect x="1" width="1" height="1" fill="black"/>
+			</svg>`, color.RGBA{255, 0, 0, 255}},
+		// the color of the SVG is kept
+		{`<svg color="#00f" width="2" height="1" xmlns="http://www.w3.org/2000/svg">
+				<rect width="1" height="1" fill="currentColor"/>
+				<rect x="1" width="1" height="1" fill="black"/>
+			</svg>`, color.RGBA{0, 0, 255, 255}},
+	} {
+		tree, err := worker.NewTreeFromData([]byte(c.svg), &Options{CurrentColor: &Color{Red: 255}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pixmap, err := worker.NewPixmap(2, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tree.Render(TransformIdentity(), pixmap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := pixmap.EncodePNG()
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := color.RGBAModel.Convert(img.At(0, 0)); got != c.want {
+			t.Fatal("currentColor must be", c.want, "got", got)
+		}
+		if got := color.RGBAModel.Convert(img.At(1, 0)); got != (color.RGBA{0, 0, 0, 255}) {
+			t.Fatal("black must be kept, got", got)
+		}
+		tree.Close()
+		pixmap.Close()
+	}
+}
+
+func TestTreeClone(t *testing.T) {
+	var svg = []byte(
+		`<svg width="100" height="100" xmlns="http://www.w3.org/2000/svg">
+			<rect id="rect1" x="10" y="10" width="80" height="80" fill="black"/>
+		</svg>`)
+	worker, err := NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	tree, err := worker.NewTreeFromData(svg, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	clone, err := tree.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = clone.SetVisible("rect1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := tree.HitTest(50, 50, TransformIdentity())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 {
+		t.Fatal("original tree must not be mutated by its clone")
+	}
+	ids, err = clone.HitTest(50, 50, TransformIdentity())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 {
+		t.Fatal("cloned tree must be mutated")
+	}
+	err = clone.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	width, height, err := tree.GetSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if width != 100.0 || height != 100.0 {
+		t.Fatal("width and height should be 100.0")
+	}
+}
+
+func TestTreeCloneSubroots(t *testing.T) {
+	var svg = []byte(
+		`<svg width="200" height="100" xmlns="http://www.w3.org/2000/svg">
+			<defs>
+				<clipPath id="clip1">
+					<text x="0" y="90" font-family="Arial" font-size="100">H</text>
+				</clipPath>
+				<pattern id="pattern1" width="100" height="100" patternUnits="userSpaceOnUse">
+					<text x="0" y="90" font-family="Arial" font-size="100">H</text>
+				</pattern>
+			</defs>
+			<rect x="0" y="0" width="100" height="100" fill="black" clip-path="url(#clip1)"/>
+			<rect x="100" y="0" width="100" height="100" fill="url(#pattern1)"/>
+		</svg>`)
+	worker, err := NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	tree, err := worker.NewTreeFromData(svg, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	clone, err := tree.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clone.Close()
+	fontdb, err := worker.NewFontDBDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fontdb.Close()
+	err = fontdb.LoadFontFile("./testdata/arial.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = clone.ConvertText(fontdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty, err := worker.NewFontDBDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer empty.Close()
+	// without fonts the texts of the original are dropped, the clone must keep its paths
+	_, err = tree.ConvertText(empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pixels := func(tree *Tree) (left int, right int) {
+		pixmap, err := worker.NewPixmap(200, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pixmap.Close()
+		err = tree.Render(TransformIdentity(), pixmap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := pixmap.Image()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for y := 0; y < 100; y++ {
+			for x := 0; x < 200; x++ {
+				if _, _, _, a := img.At(x, y).RGBA(); a != 0 && x < 100 {
+					left++
+				} else if a != 0 {
+					right++
+				}
+			}
+		}
+		return left, right
+	}
+	if left, right := pixels(clone); left == 0 || right == 0 {
+		t.Fatal("clip path and pattern texts of the clone must be converted", left, right)
+	}
+	if left, right := pixels(tree); left != 0 || right != 0 {
+		t.Fatal("clip path and pattern texts of the original must not be converted", left, right)
+	}
+}
+
+func TestTreeTexts(t *testing.T) {
+	var svg = []byte(
+		`<svg width="200" height="100" xmlns="http://www.w3.org/2000/svg">
+			<text id="text1" x="10" y="50" font-family="Arial" font-size="20">Hi</text>
+		</svg>`)
+	worker, err := NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	tree, err := worker.NewTreeFromData(svg, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	fontdb, err := worker.NewFontDBDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fontdb.Close()
+	err = fontdb.LoadFontFile("./testdata/arial.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts, err := tree.Texts(fontdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(texts) != 1 || texts[0].ID != "text1" || texts[0].Content != "Hi" {
+		t.Fatal("texts must be [text1 Hi], got", texts)
+	}
+	span := texts[0].Chunks[0].Spans[0]
+	if span.FontSize != 20 || len(span.FontFamilies) != 1 || span.FontFamilies[0] != "Arial" {
+		t.Fatal("illegal text span", span)
+	}
+	if len(texts[0].Glyphs) != 2 || texts[0].Glyphs[0].BBox == nil || texts[0].Glyphs[1].BBox == nil {
+		t.Fatal("glyphs must be laid out", texts[0].Glyphs)
+	}
+	if texts[0].Glyphs[0].BBox.X >= texts[0].Glyphs[1].BBox.X {
+		t.Fatal("glyphs must be ordered left to right")
+	}
+}
+
+func TestTreeConvertTextReport(t *testing.T) {
+	var svg = []byte(
+		`<svg width="200" height="100" xmlns="http://www.w3.org/2000/svg">
+			<text x="10" y="30" font-family="Missing, Arial">Hi</text>
+			<text x="10" y="60" font-family="Nothing">Hi</text>
+			<text x="10" y="90" font-family="Arial">中</text>
+		</svg>`)
+	worker, err := NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	tree, err := worker.NewTreeFromData(svg, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	fontdb, err := worker.NewFontDBDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fontdb.Close()
+	err = fontdb.LoadFontFile("./testdata/arial.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := tree.ConvertTextStrict(fontdb)
+	var terr *TextConversionError
+	if !errors.As(err, &terr) {
+		t.Fatal("strict text conversion must fail, got", err)
+	}
+	if len(report.FallbackFamilies) != 1 || report.FallbackFamilies[0] != (FontFallback{"Missing", "Arial"}) {
+		t.Fatal("illegal fallback families", report.FallbackFamilies)
+	}
+	if len(report.MissingFamilies) != 1 || report.MissingFamilies[0] != "Nothing" {
+		t.Fatal("illegal missing families", report.MissingFamilies)
+	}
+	if len(report.MissingGlyphs) != 1 || report.MissingGlyphs[0] != '\u4e2d' {
+		t.Fatal("illegal missing glyphs", report.MissingGlyphs)
+	}
+	report, err = tree.ConvertText(fontdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Empty() {
+		t.Fatal("report must not be empty")
+	}
+}
+
+func TestTreeConvertTextReportGlyphFallback(t *testing.T) {
+	var svg = []byte(
+		`<svg width="200" height="100" xmlns="http://www.w3.org/2000/svg">
+			<text x="10" y="50" font-family="Arial">Hi 한</text>
+		</svg>`)
+	worker, err := NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	tree, err := worker.NewTreeFromData(svg, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	fontdb, err := worker.NewFontDBDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fontdb.Close()
+	err = fontdb.LoadFontFile("./testdata/arial.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fontdb.LoadFontFile("./fonts/NanumBarunGothic.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := tree.ConvertText(fontdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.FallbackFamilies) != 1 || report.FallbackFamilies[0] != (FontFallback{"Arial", "NanumBarunGothic"}) {
+		t.Fatal("illegal fallback families", report.FallbackFamilies)
+	}
+	if len(report.MissingFamilies) != 0 || len(report.MissingGlyphs) != 0 {
+		t.Fatal("nothing must be missing", report.MissingFamilies, report.MissingGlyphs)
+	}
+}
+
+func TestFontDBFallbackFamilies(t *testing.T) {
+	var svg = []byte(
+		`<svg width="100" height="50" xmlns="http://www.w3.org/2000/svg">
+			<text x="10" y="40" font-family="Arial" font-size="30">Hi 한</text>
+		</svg>`)
+	worker, err := NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	tree, err := worker.NewTreeFromData(svg, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	fontdb, err := worker.NewFontDBDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fontdb.Close()
+	err = fontdb.LoadFontFile("./testdata/arial.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fontdb.LoadFontFile("./fonts/NanumBarunGothic.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fontdb.SetFallbackFamilies("*", []string{"Missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fontdb.SetFallbackFamilies("Hang", []string{"NanumBarunGothic"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := tree.ConvertText(fontdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Empty() {
+		t.Fatal("report must be empty, got", report)
+	}
+	pixmap, err := worker.NewPixmap(100, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pixmap.Close()
+	err = tree.Render(TransformIdentity(), pixmap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := pixmap.EncodePNG()
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var painted bool
+	for x := 60; x < 100 && !painted; x++ {
+		for y := 0; y < 50 && !painted; y++ {
+			_, _, _, a := img.At(x, y).RGBA()
+			painted = a != 0
+		}
+	}
+	if !painted {
+		t.Fatal("fallback glyph must be rendered")
+	}
+	err = worker.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fontdb.SetFallbackFamilies("*", nil)
+	if !errors.Is(err, ErrWorkerClosed) {
+		t.Fatal("must be ErrWorkerClosed, got", err)
+	}
+}
+
+func TestFontDBFaces(t *testing.T) {
+	worker, err := NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	fontdb, err := worker.NewFontDBDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fontdb.Close()
+	ttf, err := os.ReadFile("./testdata/arial.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fontdb.LoadFontData(ttf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fontdb.LoadFontFile("./testdata/arial.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	faces, err := fontdb.Faces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(faces) != 2 {
+		t.Fatal("fontdb faces must be 2")
+	}
+	if faces[0].ID == faces[1].ID {
+		t.Fatal("face ids must be unique")
+	}
+	if faces[0].Source.Blob == 0 || faces[0].Source.Path != "" {
+		t.Fatal("first face must be loaded from data", faces[0].Source)
+	}
+	if faces[1].Source.Path != "./testdata/arial.ttf" {
+		t.Fatal("second face must be loaded from file", faces[1].Source)
+	}
+	face := faces[0]
+	if len(face.Families) == 0 || face.Families[0].Name != "Arial" {
+		t.Fatal("illegal face families", face.Families)
+	}
+	if face.Style != StyleNormal || face.Weight != WeightNormal || face.Stretch != StretchNormal || face.Monospaced {
+		t.Fatal("illegal face style", face)
+	}
+}
+
+func TestFontDBQuery(t *testing.T) {
+	worker, err := NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	fontdb, err := worker.NewFontDBDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fontdb.Close()
+	err = fontdb.LoadFontFile("./testdata/arial.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	face, ok, err := fontdb.Query(Query{Families: []string{"Missing", "Arial"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || face.Families[0].Name != "Arial" {
+		t.Fatal("query must match Arial, got", face)
+	}
+	err = fontdb.SetSansSerifFamily("Arial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok, err = fontdb.Query(Query{Families: []string{"sans-serif"}, Weight: WeightBold})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("query must match sans-serif")
+	}
+	_, ok, err = fontdb.Query(Query{Families: []string{"Missing"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("query must not match Missing")
+	}
+}
+
+func TestFontDBRemove(t *testing.T) {
+	worker, err := NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	fontdb, err := worker.NewFontDBDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fontdb.Close()
+	ttf, err := os.ReadFile("./testdata/arial.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		err = fontdb.LoadFontData(ttf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = fontdb.LoadFontFile("./testdata/arial.ttf")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	faces, err := fontdb.Faces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fontdb.RemoveFace(faces[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fontdb.RemoveFace(faces[0].ID)
+	if err == nil {
+		t.Fatal("remove of a removed face must fail")
+	}
+	n, err := fontdb.RemoveBySource(FaceSource{Path: "./testdata/arial.ttf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatal("remove by source must remove 2 faces")
+	}
+	num, err := fontdb.Len()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if num != 1 {
+		t.Fatal("fontdb len must be 1")
+	}
+	err = fontdb.SetSerifFamily("Arial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fontdb.Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	num, err = fontdb.Len()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if num != 0 {
+		t.Fatal("fontdb len must be 0")
+	}
+	family, err := fontdb.SerifFamily()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if family != "Arial" {
+		t.Fatal("serif family must be kept after clear")
+	}
+	family, err = fontdb.MonospaceFamily()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if family != "Courier New" {
+		t.Fatal("monospace family must be Courier New by default, got", family)
+	}
+}
+
+func TestFontDBLoadFontsFS(t *testing.T) {
+	worker, err := NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	fontdb, err := worker.NewFontDBDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fontdb.Close()
+	ttf, err := os.ReadFile("./testdata/arial.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"fonts/arial.ttf":     {Data: ttf},
+		"fonts/sub/ARIAL.TTF": {Data: ttf},
+		"fonts/broken.otf":    {Data: []byte("not a font")},
+		"fonts/readme.txt":    {Data: []byte("not a font either")},
+	}
+	err = fontdb.LoadFontsFS(fsys, "fonts")
+	var lerr *FontLoadError
+	if !errors.As(err, &lerr) || lerr.Path != "fonts/broken.otf" || !errors.Is(err, ErrNoFaces) {
+		t.Fatal("broken.otf must be reported, got", err)
+	}
+	num, err := fontdb.Len()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if num != 2 {
+		t.Fatal("fontdb len must be 2")
+	}
+	err = fontdb.LoadFontsFS(os.DirFS("./testdata"), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFontDBLoadSystemFonts(t *testing.T) {
+	home, data := t.TempDir(), t.TempDir()
+	ttf, err := os.ReadFile("./testdata/arial.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{
+		filepath.Join(home, ".local", "share", "fonts"),
+		filepath.Join(home, ".fonts"),
+		filepath.Join(data, "fonts", "truetype"),
+	} {
+		err = os.MkdirAll(dir, 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, "arial.ttf"), ttf, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// symbolic links to directories are followed once
+	linked := t.TempDir()
+	err = os.WriteFile(filepath.Join(linked, "arial.ttf"), ttf, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(linked, filepath.Join(data, "fonts", "linked"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(filepath.Join(data, "fonts"), filepath.Join(data, "fonts", "truetype", "loop"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("XDG_DATA_DIRS", data+string(filepath.ListSeparator)+filepath.Join(home, "missing"))
+	worker, err := NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	fontdb, err := worker.NewFontDBDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fontdb.Close()
+	err = fontdb.LoadSystemFonts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	num, err := fontdb.Len()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if num != 4 {
+		t.Fatal("fontdb len must be 4")
+	}
+	faces, err := fontdb.Faces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, face := range faces {
+		if !filepath.IsAbs(face.Source.Path) || face.Source.Blob != 0 {
+			t.Fatalf("face source must be the path of the file: %+v", face.Source)
+		}
+	}
+}
+
+func TestFontRegistry(t *testing.T) {
+	registry := NewFontRegistry()
+	err := registry.AddFontFile("./testdata/arial.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.SetGenericFamilies(GenericFamilies{SansSerif: "Arial"})
+	var dbs []*FontDB
+	for i := 0; i < 2; i++ {
+		worker, err := NewDefaultWorker(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer worker.Close()
+		fontdb, err := registry.NewFontDB(worker)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fontdb.Close()
+		dbs = append(dbs, fontdb)
+	}
+	err = registry.AddFontsFS(os.DirFS("./testdata"), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fontdb := range dbs {
+		for i := 0; i < 2; i++ {
+			err = registry.Sync(fontdb)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		num, err := fontdb.Len()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if num != 2 {
+			t.Fatal("fontdb len must be 2")
+		}
+		family, err := fontdb.SansSerifFamily()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if family != "Arial" {
+			t.Fatal("sans-serif family must be Arial")
+		}
+	}
+	err = dbs[0].Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = registry.Sync(dbs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	num, err := dbs[0].Len()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if num != 2 {
+		t.Fatal("cleared fontdb must be synced again, got", num)
+	}
+}
+
+func TestConvertDir(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	svg := []byte(`<svg width="100" height="50" xmlns="http://www.w3.org/2000/svg"><rect width="100" height="50" fill="red"/></svg>`)
+	err := os.MkdirAll(filepath.Join(src, "icons"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{
+		"a.svg":       svg,
+		"icons/b.svg": svg,
+		"broken.svg":  []byte("<svg"),
+		"readme.txt":  []byte("skip"),
+		// both would be written to icons/c.png
+		"icons/c.svg":  svg,
+		"icons/c.svgz": svg,
+	} {
+		err = os.WriteFile(filepath.Join(src, name), data, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	pool, err := NewPool(context.Background(), PoolOptions{Size: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	opts := BatchOptions{
+		Sizes: []BatchSize{{Width: 50}, {Suffix: "@2x", Width: 50, Zoom: 2}},
+		Pool:  pool,
+		Skip:  SkipByHash,
+	}
+	report, err := ConvertDir(context.Background(), src, dst, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Converted != 2 || report.Skipped != 0 || len(report.Failures) != 3 {
+		t.Fatal("unexpected report", report)
+	}
+	for i, path := range []string{"broken.svg", "icons/c.svg", "icons/c.svgz"} {
+		if report.Failures[i].Path != path {
+			t.Fatal("unexpected failure", report.Failures[i])
+		}
+	}
+	_, err = os.Stat(filepath.Join(dst, "icons", "c.png"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal("colliding outputs must not be written", err)
+	}
+	for name, width := range map[string]int{"a.png": 50, "a@2x.png": 100, "icons/b.png": 50, "icons/b@2x.png": 100} {
+		f, err := os.Open(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := png.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Width != width || cfg.Height != width/2 {
+			t.Fatal(name, "size must be", width, width/2)
+		}
+	}
+	report, err = ConvertDir(context.Background(), src, dst, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Converted != 0 || report.Skipped != 2 {
+		t.Fatal("unchanged files must be skipped", report)
+	}
+	opts.Sizes = opts.Sizes[:1]
+	report, err = ConvertDir(context.Background(), src, dst, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Converted != 2 {
+		t.Fatal("files of changed sizes must be converted", report)
+	}
+}
+
+func TestConvertDirWarnings(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	for name, data := range map[string]string{
+		"rect.svg": `<svg width="100" height="50" xmlns="http://www.w3.org/2000/svg"><rect width="100" height="50"/></svg>`,
+		"text.svg": `<svg width="100" height="50" xmlns="http://www.w3.org/2000/svg"><text x="10" y="30" font-family="Nothing">Hi</text></svg>`,
+	} {
+		err := os.WriteFile(filepath.Join(src, name), []byte(data), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	report, err := ConvertDir(context.Background(), src, dst, BatchOptions{Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Converted != 2 || len(report.Failures) != 0 || len(report.Warnings) != 1 {
+		t.Fatal("unexpected report", report)
+	}
+	if w := report.Warnings[0]; w.Path != "text.svg" || len(w.Text.MissingFamilies) != 1 || w.Text.MissingFamilies[0] != "Nothing" {
+		t.Fatal("unexpected warning", w)
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	for s, want := range map[string]struct {
+		color Color
+		alpha uint8
+	}{
+		"#fff":      {Color{Red: 255, Green: 255, Blue: 255}, 255},
+		"#f008":     {Color{Red: 255}, 0x88},
+		"#102030":   {Color{Red: 0x10, Green: 0x20, Blue: 0x30}, 255},
+		"#10203040": {Color{Red: 0x10, Green: 0x20, Blue: 0x30}, 0x40},
+	} {
+		color, alpha, err := ParseColor(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if color != want.color || alpha != want.alpha {
+			t.Fatal(s, color, alpha)
+		}
+	}
+	for _, s := range []string{"", "fff", "#ff", "#ggg", "#1020304"} {
+		_, _, err := ParseColor(s)
+		if err == nil {
+			t.Fatal(s)
+		}
+	}
+}
+
+func TestFontDBFingerprint(t *testing.T) {
+	worker, err := NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	font, err := os.ReadFile("./testdata/arial.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fingerprints []string
+	for i := 0; i < 2; i++ {
+		fontdb, err := worker.NewFontDBDefault()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fontdb.Close()
+		empty := fontdb.Fingerprint()
+		err = fontdb.LoadFontData(font)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fontdb.Fingerprint() == empty {
+			t.Fatal("fingerprint must change with the fonts")
+		}
+		err = fontdb.SetSansSerifFamily("Arial")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fingerprints = append(fingerprints, fontdb.Fingerprint())
+	}
+	if fingerprints[0] != fingerprints[1] {
+		t.Fatal("fontdbs loaded the same way must have the same fingerprint")
+	}
+	registry := NewFontRegistry()
+	empty := registry.Fingerprint()
+	registry.AddFontData(font)
+	if registry.Fingerprint() == empty {
+		t.Fatal("registry fingerprint must change with the fonts")
+	}
+}
+
+func TestTreeCache(t *testing.T) {
+	worker, err := NewDefaultWorker(context.Background(), WithTreeCache(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	trees := worker.TreeCache()
+	svg := []byte(`<svg width="100" height="100" xmlns="http://www.w3.org/2000/svg"><rect width="10" height="10"/></svg>`)
+	first, err := trees.Tree(svg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := trees.Tree(svg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree != first {
+		t.Fatal("tree of the same svg must be cached")
+	}
+	_, err = trees.Tree(svg, &Options{Dpi: 72}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = trees.Tree(svg, &Options{Dpi: 300}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trees.Len() != 2 {
+		t.Fatal("cache len must be 2")
+	}
+	_, _, err = first.GetSize()
+	if !errors.Is(err, ErrClosed) {
+		t.Fatal("evicted tree must be closed, got", err)
+	}
+	stats := worker.Stats()
+	if stats.TreeCacheHits != 1 || stats.TreeCacheMisses != 3 {
+		t.Fatal("unexpected hits and misses", stats.TreeCacheHits, stats.TreeCacheMisses)
+	}
+	trees.Clear()
+	if trees.Len() != 0 || worker.Stats().Trees != 0 {
+		t.Fatal("cleared cache must close the trees")
+	}
+}
+
+func TestRenderTiles(t *testing.T) {
+	worker, err := NewDefaultWorker(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+	tree, err := worker.NewTreeFromData([]byte(
+		`<svg width="100" height="60" xmlns="http://www.w3.org/2000/svg"><rect width="100" height="60" fill="red"/></svg>`,
+	), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+	var tiles [][2]int
+	err = tree.RenderTiles(64, 2, func(x int, y int, tile *Pixmap) error {
+		width, height, err := tile.GetSize()
+		if err != nil {
+			return err
+		}
+		if width != 64 || height != 64 {
+			t.Fatal("tile size must be 64x64")
+		}
+		img, err := tile.Image()
+		if err != nil {
+			return err
+		}
+		// the reused tile is cleared past the right edge at 200px
+		if _, _, _, a := img.At(32, 32).RGBA(); (x == 3) != (a == 0) {
+			t.Fatal("unexpected pixel of tile", x, y, img.At(32, 32))
+		}
+		tiles = append(tiles, [2]int{x, y})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 200x120 in 4x2 tiles, row by row
+	if len(tiles) != 8 || tiles[3] != [2]int{3, 0} || tiles[4] != [2]int{0, 1} {
+		t.Fatal("unexpected tiles", tiles)
+	}
+	err = tree.RenderTiles(0, 1, nil)
+	if !errors.Is(err, ErrInvalidTile) {
+		t.Fatal("tile size 0 must be ErrInvalidTile")
+	}
+	var width int64 = math.MaxInt32 + 1
+	if int64(int(width)) == width {
+		_, err = newPNGStream(io.Discard, int(width), 1)
+		if !errors.Is(err, ErrImageTooLarge) {
+			t.Fatal("a PNG wider than 2^31-1 must be ErrImageTooLarge, got", err)
+		}
+	}
+	dir := t.TempDir()
+	err = tree.WriteSlippyTiles(dir, 64, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"0/0/0.png", "1/0/0.png", "1/1/0.png", "1/0/1.png", "1/1/1.png"} {
+		_, err = os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	err = tree.EncodeTiledPNG(&buf, 64, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 200 || img.Bounds().Dy() != 120 {
+		t.Fatal("image size must be 200x120")
+	}
+	r, g, b, a := img.At(199, 119).RGBA()
+	if r != 0xffff || g != 0 || b != 0 || a != 0xffff {
+		t.Fatal("image must be red", r, g, b, a)
+	}
+}
+
+func TestPNGStream(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := newPNGStream(&buf, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0}
+	// premultiplied half transparent white and opaque blue
+	unpremultiply(row[1:], []byte{128, 128, 128, 128, 0, 0, 255, 255})
+	_, err = enc.Write(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = enc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := img.(*image.NRGBA).NRGBAAt(0, 0); c != (color.NRGBA{255, 255, 255, 128}) {
+		t.Fatal("pixel must be half transparent white", c)
+	}
+	if c := img.(*image.NRGBA).NRGBAAt(1, 0); c != (color.NRGBA{0, 0, 255, 255}) {
+		t.Fatal("pixel must be blue", c)
+	}
+}
@@ -0,0 +1,102 @@
+package resvg
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/kanrichan/resvg-go/internal"
+)
+
+// WorkerStats statistics of a `Worker`, such as to be exported by expvar.
+type WorkerStats struct {
+	// MemorySize the size of the wasm linear memory in bytes,
+	// which never shrinks.
+	MemorySize uint64
+	// HeapInUse the bytes allocated in the wasm heap as of the last render.
+	HeapInUse uint64
+	// HeapPeak the most bytes ever allocated in the wasm heap
+	// as of the last render.
+	HeapPeak uint64
+	// HeapErr the error reading HeapInUse and HeapPeak at the last render.
+	HeapErr error
+	// Trees, Pixmaps and FontDBs the number of live handles.
+	Trees   int64
+	Pixmaps int64
+	FontDBs int64
+	// PixmapBytes the bytes held by the live `Pixmap`s.
+	PixmapBytes int64
+	// FontBytes the bytes of the font data loaded into the live `FontDB`s,
+	// faces removed by `RemoveFace` or `RemoveBySource` are still counted.
+	FontBytes int64
+	// Renders the number of renders.
+	Renders uint64
+	// TreeCacheHits and TreeCacheMisses the lookups of the `TreeCache`s,
+	// each miss parses a `Tree`.
+	TreeCacheHits   uint64
+	TreeCacheMisses uint64
+	// WasmTime the time spent in calls on the `Worker`.
+	WasmTime time.Duration
+	// Finalized the number of `Tree`, `Pixmap` and `FontDB` that were
+	// garbage collected without `Close`, each one is a missing `Close` call.
+	Finalized uint64
+	// PendingFrees the number of finalized handles whose wasm memory is
+	// freed at the next call on the `Worker`.
+	PendingFrees int
+}
+
+// workerCounters the counters behind `WorkerStats`,
+// updated by the holder of the `Worker` and read by `Stats`.
+type workerCounters struct {
+	memorySize      atomic.Uint64
+	heapInUse       atomic.Uint64
+	heapPeak        atomic.Uint64
+	trees           atomic.Int64
+	pixmaps         atomic.Int64
+	fontdbs         atomic.Int64
+	pixmapBytes     atomic.Int64
+	fontBytes       atomic.Int64
+	renders         atomic.Uint64
+	treeCacheHits   atomic.Uint64
+	treeCacheMisses atomic.Uint64
+	wasmTime        atomic.Int64
+	finalized       atomic.Uint64
+}
+
+// Stats returns the statistics of the `Worker`.
+// Unlike the other methods, `Stats` is goroutine-safe.
+func (wk *Worker) Stats() WorkerStats {
+	wk.mu.Lock()
+	pending := len(wk.pending)
+	heapErr := wk.heapErr
+	wk.mu.Unlock()
+	return WorkerStats{
+		MemorySize:      wk.stats.memorySize.Load(),
+		HeapInUse:       wk.stats.heapInUse.Load(),
+		HeapPeak:        wk.stats.heapPeak.Load(),
+		HeapErr:         heapErr,
+		Trees:           wk.stats.trees.Load(),
+		Pixmaps:         wk.stats.pixmaps.Load(),
+		FontDBs:         wk.stats.fontdbs.Load(),
+		PixmapBytes:     wk.stats.pixmapBytes.Load(),
+		FontBytes:       wk.stats.fontBytes.Load(),
+		Renders:         wk.stats.renders.Load(),
+		TreeCacheHits:   wk.stats.treeCacheHits.Load(),
+		TreeCacheMisses: wk.stats.treeCacheMisses.Load(),
+		WasmTime:        time.Duration(wk.stats.wasmTime.Load()),
+		Finalized:       wk.stats.finalized.Load(),
+		PendingFrees:    pending,
+	}
+}
+
+// readHeapStats updates the heap statistics, it is called after the renders,
+// which allocate the most, rather than on every call. The `Worker` must be acquired.
+func (wk *Worker) readHeapStats() {
+	inUse, peak, err := internal.MemoryHeapStats(wk.ctx, wk.mod)
+	if err == nil {
+		wk.stats.heapInUse.Store(uint64(inUse))
+		wk.stats.heapPeak.Store(uint64(peak))
+	}
+	wk.mu.Lock()
+	wk.heapErr = err
+	wk.mu.Unlock()
+}
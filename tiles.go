@@ -0,0 +1,299 @@
+package resvg
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/kanrichan/resvg-go/internal"
+)
+
+// ErrInvalidTile returned when the tile size or the zoom of tiled rendering is not positive.
+var ErrInvalidTile = errors.New("tile size and zoom must be positive")
+
+// ErrImageTooLarge returned by `EncodeTiledPNG` when the image zoomed is wider
+// or higher than a PNG can be.
+var ErrImageTooLarge = errors.New("image is too large for a PNG")
+
+// tileGrid returns the size in pixels of the tree zoomed and the number of tiles covering it.
+func (t *Tree) tileGrid(tileSize uint32, zoom float32) (int, int, int, int, error) {
+	if tileSize == 0 || zoom <= 0 {
+		return 0, 0, 0, 0, ErrInvalidTile
+	}
+	w, h, err := t.GetSize()
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	// tolerate the rounding of float32, such as a side of exactly 2^z tiles
+	width := int(math.Ceil(float64(w*zoom) - 1e-3))
+	height := int(math.Ceil(float64(h*zoom) - 1e-3))
+	if width <= 0 || height <= 0 {
+		return 0, 0, 0, 0, ErrEmptySize
+	}
+	size := int(tileSize)
+	return width, height, (width + size - 1) / size, (height + size - 1) / size, nil
+}
+
+// RenderTiles renders the tree scaled by the zoom as square tiles of tileSize pixels,
+// so that images larger than a single `Pixmap` can be rendered.
+// The fn is called row by row, left to right, with the column x and the row y
+// of each tile. The tiles of the right and bottom edges are transparent past the
+// image. The tile is reused by the next tile and closed after the last one,
+// an error of fn stops the rendering. The tree is rendered as it was when
+// `RenderTiles` was called, changes made by fn are left to the next call.
+func (t *Tree) RenderTiles(tileSize uint32, zoom float32, fn func(x int, y int, tile *Pixmap) error) error {
+	_, _, cols, rows, err := t.tileGrid(tileSize, zoom)
+	if err != nil {
+		return err
+	}
+	tile, err := t.wk.NewPixmap(tileSize, tileSize)
+	if err != nil {
+		return err
+	}
+	defer tile.Close()
+	rt, err := t.newRenderTree()
+	if err != nil {
+		return err
+	}
+	defer t.deleteRenderTree(rt)
+	size := float32(tileSize)
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			err = t.renderTile(rt, TransformFromRow(zoom, 0, 0, zoom, -float32(x)*size, -float32(y)*size), tile)
+			if err != nil {
+				return err
+			}
+			err = fn(x, y, tile)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// newRenderTree converts the tree for rendering once for all the tiles.
+func (t *Tree) newRenderTree() (int32, error) {
+	if err := t.wk.acquire(); err != nil {
+		return 0, err
+	}
+	defer t.wk.release()
+	if t.ptr == 0 {
+		return 0, ErrClosed
+	}
+	return internal.ResvgTreeFromUsvg(t.wk.ctx, t.wk.mod, t.ptr)
+}
+
+func (t *Tree) deleteRenderTree(rt int32) error {
+	if err := t.wk.acquire(); err != nil {
+		return err
+	}
+	defer t.wk.release()
+	return internal.ResvgTreeDelete(t.wk.ctx, t.wk.mod, rt)
+}
+
+// renderTile clears the tile and renders the converted tree rt into it.
+func (t *Tree) renderTile(rt int32, transform transform, tile *Pixmap) (err error) {
+	end := t.wk.observe(OperationRender, 0)
+	defer func() { end(int(tile.size), err) }()
+	if err := t.wk.acquire(); err != nil {
+		return err
+	}
+	defer t.wk.release()
+	if tile.ptr == 0 {
+		return ErrClosed
+	}
+	err = internal.TinySkiaPixmapFill(t.wk.ctx, t.wk.mod, tile.ptr, 0, 0, 0, 0)
+	if err != nil {
+		return err
+	}
+	tf, err := transform(t.wk.ctx, t.wk.mod)
+	if err != nil {
+		return err
+	}
+	defer internal.TinySkiaTransformDelete(t.wk.ctx, t.wk.mod, tf)
+	t.wk.stats.renders.Add(1)
+	err = internal.ResvgTreeRender(t.wk.ctx, t.wk.mod, rt, tf, tile.ptr)
+	t.wk.readHeapStats()
+	return err
+}
+
+// EncodeTiledPNG renders the tree scaled by the zoom tile by tile and streams it
+// as a PNG into w, holding a single row of tiles in memory instead of the whole image.
+// Returns `ErrInvalidTile` or `ErrImageTooLarge` before anything is written.
+func (t *Tree) EncodeTiledPNG(w io.Writer, tileSize uint32, zoom float32) error {
+	width, height, cols, _, err := t.tileGrid(tileSize, zoom)
+	if err != nil {
+		return err
+	}
+	enc, err := newPNGStream(w, width, height)
+	if err != nil {
+		return err
+	}
+	size := int(tileSize)
+	stride := 1 + width*4
+	band := make([]byte, size*stride)
+	err = t.RenderTiles(tileSize, zoom, func(x int, y int, tile *Pixmap) error {
+		img, err := tile.Image()
+		if err != nil {
+			return err
+		}
+		rows := min(size, height-y*size)
+		pixels := min(size, width-x*size)
+		for r := 0; r < rows; r++ {
+			src := img.Pix[r*img.Stride : r*img.Stride+pixels*4]
+			dst := band[r*stride+1+x*size*4:]
+			unpremultiply(dst, src)
+		}
+		if x < cols-1 {
+			return nil
+		}
+		// the row of tiles is complete
+		_, err = enc.Write(band[:rows*stride])
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// unpremultiply copies the alpha-premultiplied RGBA pixels of src into dst as straight alpha.
+func unpremultiply(dst []byte, src []byte) {
+	for i := 0; i+3 < len(src); i += 4 {
+		a := uint32(src[i+3])
+		switch a {
+		case 0:
+			dst[i], dst[i+1], dst[i+2], dst[i+3] = 0, 0, 0, 0
+		case 255:
+			copy(dst[i:i+4], src[i:i+4])
+		default:
+			dst[i] = uint8((uint32(src[i])*255 + a/2) / a)
+			dst[i+1] = uint8((uint32(src[i+1])*255 + a/2) / a)
+			dst[i+2] = uint8((uint32(src[i+2])*255 + a/2) / a)
+			dst[i+3] = uint8(a)
+		}
+	}
+}
+
+// pngStream writes an 8-bit RGBA PNG from its filtered scanlines,
+// each one a filter type byte of 0 (none) followed by the pixels.
+type pngStream struct {
+	w    io.Writer
+	idat *bufio.Writer
+	z    *zlib.Writer
+}
+
+func newPNGStream(w io.Writer, width int, height int) (*pngStream, error) {
+	if width > math.MaxInt32 || height > math.MaxInt32 {
+		return nil, ErrImageTooLarge
+	}
+	_, err := io.WriteString(w, "\x89PNG\r\n\x1a\n")
+	if err != nil {
+		return nil, err
+	}
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(width))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(height))
+	// bit depth 8, color type 6 (RGBA), compression, filter and interlace 0
+	ihdr[8], ihdr[9] = 8, 6
+	err = writePNGChunk(w, "IHDR", ihdr)
+	if err != nil {
+		return nil, err
+	}
+	s := &pngStream{w: w}
+	// each flush of the buffer is an IDAT chunk
+	s.idat = bufio.NewWriterSize(pngChunkWriter{w}, 64<<10)
+	s.z = zlib.NewWriter(s.idat)
+	return s, nil
+}
+
+// Write writes filtered scanlines.
+func (s *pngStream) Write(p []byte) (int, error) {
+	return s.z.Write(p)
+}
+
+// Close ends the image, it doesn't close the underlying writer.
+func (s *pngStream) Close() error {
+	err := s.z.Close()
+	if err != nil {
+		return err
+	}
+	err = s.idat.Flush()
+	if err != nil {
+		return err
+	}
+	return writePNGChunk(s.w, "IEND", nil)
+}
+
+// pngChunkWriter writes each write as an IDAT chunk.
+type pngChunkWriter struct {
+	w io.Writer
+}
+
+func (cw pngChunkWriter) Write(p []byte) (int, error) {
+	err := writePNGChunk(cw.w, "IDAT", p)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func writePNGChunk(w io.Writer, typ string, data []byte) error {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(len(data)))
+	copy(header[4:], typ)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	footer := binary.BigEndian.AppendUint32(nil, crc.Sum32())
+	for _, b := range [][]byte{header, data, footer} {
+		_, err := w.Write(b)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteSlippyTiles writes the tiles of the zoom levels from minZoom to maxZoom
+// as PNGs in the `dir/z/x/y.png` layout of slippy maps, such as for Leaflet or OpenLayers.
+// At the level z, the longest side of the tree spans 2^z tiles of tileSize pixels.
+func (t *Tree) WriteSlippyTiles(dir string, tileSize uint32, minZoom int, maxZoom int) error {
+	if minZoom < 0 || maxZoom < minZoom || maxZoom > 30 {
+		return fmt.Errorf("invalid zoom levels %d to %d", minZoom, maxZoom)
+	}
+	w, h, err := t.GetSize()
+	if err != nil {
+		return err
+	}
+	side := max(w, h)
+	for z := minZoom; z <= maxZoom; z++ {
+		zoom := float32(tileSize) * float32(int(1)<<z) / side
+		level := filepath.Join(dir, strconv.Itoa(z))
+		err = t.RenderTiles(tileSize, zoom, func(x int, y int, tile *Pixmap) error {
+			data, err := tile.EncodePNG()
+			if err != nil {
+				return err
+			}
+			col := filepath.Join(level, strconv.Itoa(x))
+			err = os.MkdirAll(col, 0o755)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(filepath.Join(col, strconv.Itoa(y)+".png"), data, 0o644)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,13 +1,148 @@
 package resvg
 
 import (
+	"bytes"
+	"compress/gzip"
 	_ "embed"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 
 	"github.com/kanrichan/resvg-go/internal"
 )
 
+// NodeID the `id` attribute of an SVG element.
+type NodeID string
+
+// Color an RGB color.
+type Color struct {
+	Red   uint8
+	Green uint8
+	Blue  uint8
+}
+
+// ParseColor parses a `#rgb`, `#rgba`, `#rrggbb` or `#rrggbbaa` color and its alpha.
+func ParseColor(s string) (Color, uint8, error) {
+	hex, ok := strings.CutPrefix(s, "#")
+	if ok && (len(hex) == 3 || len(hex) == 4) {
+		var long strings.Builder
+		for _, c := range hex {
+			long.WriteRune(c)
+			long.WriteRune(c)
+		}
+		hex = long.String()
+	}
+	if !ok || (len(hex) != 6 && len(hex) != 8) {
+		return Color{}, 0, fmt.Errorf("invalid color %q", s)
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return Color{}, 0, fmt.Errorf("invalid color %q", s)
+	}
+	return Color{Red: uint8(v >> 24), Green: uint8(v >> 16), Blue: uint8(v >> 8)}, uint8(v), nil
+}
+
+// Rect a rectangle.
+type Rect struct {
+	X      float32 `json:"x"`
+	Y      float32 `json:"y"`
+	Width  float32 `json:"width"`
+	Height float32 `json:"height"`
+}
+
+// Text a text node of the `Tree`.
+type Text struct {
+	ID NodeID `json:"id"`
+	// Content the text of all chunks.
+	Content string      `json:"content"`
+	Chunks  []TextChunk `json:"chunks"`
+	// Glyphs the characters of all chunks with their bounding boxes,
+	// only set when laid out against a `FontDB`.
+	Glyphs []Glyph `json:"glyphs"`
+}
+
+// TextChunk a text chunk, started by an absolute position.
+type TextChunk struct {
+	// X, Y the position of the chunk, nil when inherited from the previous chunk.
+	X       *float32   `json:"x"`
+	Y       *float32   `json:"y"`
+	Content string     `json:"content"`
+	Spans   []TextSpan `json:"spans"`
+}
+
+// TextSpan a part of a text chunk with the same style.
+type TextSpan struct {
+	Content      string   `json:"content"`
+	FontFamilies []string `json:"font_families"`
+	FontSize     float32  `json:"font_size"`
+}
+
+// Glyph a laid out character.
+type Glyph struct {
+	Text string `json:"text"`
+	// BBox the bounding box of the glyphs of its cluster in the SVG coordinates,
+	// nil when nothing is drawn, or for text on a path and vertical text.
+	BBox *Rect `json:"bbox"`
+}
+
+// setCurrentColor returns the SVG data with the `color` attribute of the root
+// element set to the color, unless it has one. The data is decompressed if needed.
+func setCurrentColor(data []byte, color Color) ([]byte, error) {
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrMalformedGZip
+		}
+		data, err = io.ReadAll(zr)
+		if err != nil {
+			return nil, ErrMalformedGZip
+		}
+	}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	// only the offsets of the markup are needed
+	d.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	for {
+		offset := d.InputOffset()
+		tok, err := d.Token()
+		if err != nil {
+			// left to the parser
+			return data, nil
+		}
+		root, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		for _, attr := range root.Attr {
+			if attr.Name.Space == "" && attr.Name.Local == "color" {
+				return data, nil
+			}
+		}
+		if int(offset) >= len(data) || data[offset] != '<' {
+			return data, nil
+		}
+		// after the name of the root element
+		i := int(offset) + 1
+		for i < len(data) && !strings.ContainsRune(" \t\r\n/>", rune(data[i])) {
+			i++
+		}
+		attr := fmt.Sprintf(` color="#%02x%02x%02x"`, color.Red, color.Green, color.Blue)
+		out := make([]byte, 0, len(data)+len(attr))
+		out = append(out, data[:i]...)
+		out = append(out, attr...)
+		return append(out, data[i:]...), nil
+	}
+}
+
 // Tree SVG tree
 type Tree struct {
 	wk  *Worker
@@ -16,11 +151,15 @@ type Tree struct {
 
 // NewTreeFromData parses `Tree` from an SVG data.
 // Can contain a gzip compressed data.
-func (wk *Worker) NewTreeFromData(data []byte, options *Options) (*Tree, error) {
-	if !wk.used.CompareAndSwap(false, true) {
-		return nil, ErrWorkerIsBeingUsed
+// Returns `ErrNotUTF8`, `ErrMalformedGZip`, `ErrElementsLimitReached`,
+// `ErrInvalidSize` or a `*ParseError` when the data can't be parsed.
+func (wk *Worker) NewTreeFromData(data []byte, options *Options) (_ *Tree, err error) {
+	end := wk.observe(OperationNewTreeFromData, len(data))
+	defer func() { end(0, err) }()
+	if err := wk.acquire(); err != nil {
+		return nil, err
 	}
-	defer wk.used.Store(false)
+	defer wk.release()
 	o, err := internal.UsvgOptionsDefault(wk.ctx, wk.mod)
 	if err != nil {
 		return nil, err
@@ -61,22 +200,22 @@ func (wk *Worker) NewTreeFromData(data []byte, options *Options) (*Tree, error)
 				strings.Join(options.Languages, " "),
 			)
 		}
-		if options.ShapeRenderingMode != 0 {
+		if options.ShapeRenderingMode != ShapeRenderingModeDefault {
 			internal.UsvgOptionsSetShapeRenderingMode(
 				wk.ctx, wk.mod, o,
-				int32(options.ShapeRenderingMode),
+				int32(options.ShapeRenderingMode)-1,
 			)
 		}
-		if options.TextRenderingMode != 0 {
+		if options.TextRenderingMode != TextRenderingModeDefault {
 			internal.UsvgOptionsSetTextRenderingMode(
 				wk.ctx, wk.mod, o,
-				int32(options.TextRenderingMode),
+				int32(options.TextRenderingMode)-1,
 			)
 		}
-		if options.ImageRenderingMode != 0 {
+		if options.ImageRenderingMode != ImageRenderingModeDefault {
 			internal.UsvgOptionsSetImageRenderingMode(
 				wk.ctx, wk.mod, o,
-				int32(options.ImageRenderingMode),
+				int32(options.ImageRenderingMode)-1,
 			)
 		}
 		if options.DefaultSizeWidth != 0 && options.DefaultSizeHeight != 0 {
@@ -85,57 +224,219 @@ func (wk *Worker) NewTreeFromData(data []byte, options *Options) (*Tree, error)
 				options.DefaultSizeHeight,
 			)
 		}
+		if options.BlockExternalImages {
+			// not ignored: the images must not be loaded if it fails
+			err = internal.UsvgOptionsBlockExternalImages(wk.ctx, wk.mod, o)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if options != nil && options.CurrentColor != nil {
+		data, err = setCurrentColor(data, *options.CurrentColor)
+		if err != nil {
+			return nil, err
+		}
 	}
 	t, err := internal.UsvgTreeFromData(wk.ctx, wk.mod, data, o)
 	if err != nil {
 		return nil, err
 	}
-	return &Tree{wk, t}, nil
+	tree := &Tree{wk: wk, ptr: t}
+	wk.track(handleTree, 0)
+	runtime.SetFinalizer(tree, (*Tree).finalize)
+	return tree, nil
 }
 
 // Close cloes the `Tree` and recovers memory.
 func (t *Tree) Close() error {
-	if !t.wk.used.CompareAndSwap(false, true) {
-		return ErrWorkerIsBeingUsed
+	if err := t.wk.acquire(); err != nil {
+		return err
 	}
-	defer t.wk.used.Store(false)
+	defer t.wk.release()
 	if t.ptr == 0 {
-		return ErrPointerIsNil
+		return ErrClosed
 	}
 	err := internal.UsvgTreeDelete(t.wk.ctx, t.wk.mod, t.ptr)
 	if err != nil {
 		return err
 	}
 	t.ptr = 0
+	t.wk.untrack(handleTree, 0)
+	runtime.SetFinalizer(t, nil)
 	return nil
 }
 
+// finalize queues the wasm memory of a `Tree` that was not closed to be freed.
+func (t *Tree) finalize() {
+	t.wk.finalize(handleTree, t.ptr, 0)
+}
+
+// Clone deep-copies the `Tree`, clip paths, masks and patterns included, inside the same worker,
+// the copy can be mutated and text-converted independently.
+// `Tree` are not goroutine-safe, don't forget to close!
+func (t *Tree) Clone() (*Tree, error) {
+	if err := t.wk.acquire(); err != nil {
+		return nil, err
+	}
+	defer t.wk.release()
+	if t.ptr == 0 {
+		return nil, ErrClosed
+	}
+	c, err := internal.UsvgTreeClone(t.wk.ctx, t.wk.mod, t.ptr)
+	if err != nil {
+		return nil, err
+	}
+	clone := &Tree{wk: t.wk, ptr: c}
+	t.wk.track(handleTree, 0)
+	runtime.SetFinalizer(clone, (*Tree).finalize)
+	return clone, nil
+}
+
+// TextConversionReport the fonts and glyphs `ConvertText` couldn't find.
+type TextConversionReport struct {
+	// FallbackFamilies requested families that weren't found, with the family
+	// used instead, and fonts missing glyphs, with the font drawing them instead.
+	FallbackFamilies []FontFallback `json:"fallback_families"`
+	// MissingFamilies families of `font-family` lists without any match,
+	// not even the serif family, the text using them is dropped.
+	MissingFamilies []string `json:"missing_families"`
+	// MissingGlyphs codepoints without a glyph in any loaded face.
+	MissingGlyphs []rune `json:"missing_glyphs"`
+}
+
+// FontFallback a requested family or font and the one used instead.
+type FontFallback struct {
+	Family   string `json:"family"`
+	Fallback string `json:"fallback"`
+}
+
+// Empty reports whether all fonts and glyphs were found, a nil report is empty.
+func (r *TextConversionReport) Empty() bool {
+	return r == nil || len(r.FallbackFamilies) == 0 && len(r.MissingFamilies) == 0 && len(r.MissingGlyphs) == 0
+}
+
+// TextConversionError returned by `ConvertTextStrict` when the report isn't empty.
+type TextConversionError struct {
+	Report *TextConversionReport
+}
+
+// String describes the fallbacks and the missing fonts and glyphs of the report.
+func (r *TextConversionReport) String() string {
+	var msgs []string
+	for _, f := range r.FallbackFamilies {
+		msgs = append(msgs, fmt.Sprintf("font family %q fell back to %q", f.Family, f.Fallback))
+	}
+	if len(r.MissingFamilies) != 0 {
+		msgs = append(msgs, fmt.Sprintf("no font found for families %q", r.MissingFamilies))
+	}
+	if len(r.MissingGlyphs) != 0 {
+		msgs = append(msgs, fmt.Sprintf("no glyph found for %q", string(r.MissingGlyphs)))
+	}
+	return strings.Join(msgs, ", ")
+}
+
+func (e *TextConversionError) Error() string {
+	return "text conversion: " + e.Report.String()
+}
+
 // ConvertText converts text nodes into `Tree`.
-func (t *Tree) ConvertText(fontdb *FontDB) error {
+// Text whose font can't be found in the fontdb is dropped,
+// the returned report lists the fonts and glyphs that were missing.
+// Glyphs missing from the primary face are drawn with the fallback families
+// of the fontdb, see `FontDB.SetFallbackFamilies`.
+func (t *Tree) ConvertText(fontdb *FontDB) (*TextConversionReport, error) {
+	return t.convertText(fontdb, false)
+}
+
+// ConvertTextStrict is like `ConvertText` but returns a `*TextConversionError`
+// and leaves the text unconverted when any font or glyph is missing.
+func (t *Tree) ConvertTextStrict(fontdb *FontDB) (*TextConversionReport, error) {
+	return t.convertText(fontdb, true)
+}
+
+func (t *Tree) convertText(fontdb *FontDB, strict bool) (_ *TextConversionReport, err error) {
+	end := t.wk.observe(OperationConvertText, 0)
+	defer func() { end(0, err) }()
 	if t.wk != fontdb.wk {
-		return ErrPointerIsNil
+		return nil, ErrWorkerMismatch
 	}
-	if !t.wk.used.CompareAndSwap(false, true) {
-		return ErrWorkerIsBeingUsed
+	if err := t.wk.acquire(); err != nil {
+		return nil, err
 	}
-	defer t.wk.used.Store(false)
+	defer t.wk.release()
 	if t.ptr == 0 {
-		return ErrPointerIsNil
+		return nil, ErrClosed
 	}
 	if fontdb.ptr == 0 {
-		return ErrPointerIsNil
+		return nil, ErrClosed
+	}
+	if len(fontdb.fallbacks) != 0 {
+		fallbacks, err := json.Marshal(fontdb.fallbacks)
+		if err != nil {
+			return nil, err
+		}
+		err = internal.UsvgTreeApplyFontFallback(t.wk.ctx, t.wk.mod, t.ptr, fontdb.ptr, string(fallbacks))
+		if err != nil {
+			return nil, err
+		}
+	}
+	data, err := internal.UsvgTreeConvertTextReport(t.wk.ctx, t.wk.mod, t.ptr, fontdb.ptr, strict)
+	if err != nil {
+		return nil, err
+	}
+	var report TextConversionReport
+	err = json.Unmarshal(data, &report)
+	if err != nil {
+		return nil, err
+	}
+	if strict && !report.Empty() {
+		return &report, &TextConversionError{&report}
+	}
+	return &report, nil
+}
+
+// Texts returns the text nodes of the `Tree`.
+// Glyphs are laid out against the fontdb unless it is nil.
+// Texts are gone after `ConvertText`.
+func (t *Tree) Texts(fontdb *FontDB) ([]Text, error) {
+	var db int32
+	if fontdb != nil {
+		if t.wk != fontdb.wk {
+			return nil, ErrWorkerMismatch
+		}
+		if fontdb.ptr == 0 {
+			return nil, ErrClosed
+		}
+		db = fontdb.ptr
+	}
+	if err := t.wk.acquire(); err != nil {
+		return nil, err
 	}
-	return internal.UsvgTreeConvertText(t.wk.ctx, t.wk.mod, t.ptr, fontdb.ptr)
+	defer t.wk.release()
+	if t.ptr == 0 {
+		return nil, ErrClosed
+	}
+	data, err := internal.UsvgTreeTexts(t.wk.ctx, t.wk.mod, t.ptr, db)
+	if err != nil {
+		return nil, err
+	}
+	var texts []Text
+	err = json.Unmarshal(data, &texts)
+	if err != nil {
+		return nil, err
+	}
+	return texts, nil
 }
 
 // GetSize returns Tree's width and height.
 func (t *Tree) GetSize() (float32, float32, error) {
-	if !t.wk.used.CompareAndSwap(false, true) {
-		return 0, 0, ErrWorkerIsBeingUsed
+	if err := t.wk.acquire(); err != nil {
+		return 0, 0, err
 	}
-	defer t.wk.used.Store(false)
+	defer t.wk.release()
 	if t.ptr == 0 {
-		return 0, 0, ErrPointerIsNil
+		return 0, 0, ErrClosed
 	}
 	width, err := internal.UsvgTreeGetWidth(t.wk.ctx, t.wk.mod, t.ptr)
 	if err != nil {
@@ -149,19 +450,21 @@ func (t *Tree) GetSize() (float32, float32, error) {
 }
 
 // Render renders the tree onto the pixmap.
-func (t *Tree) Render(transform transform, pixmap *Pixmap) error {
+func (t *Tree) Render(transform transform, pixmap *Pixmap) (err error) {
+	end := t.wk.observe(OperationRender, 0)
+	defer func() { end(int(pixmap.size), err) }()
 	if t.wk != pixmap.wk {
-		return ErrPointerIsNil
+		return ErrWorkerMismatch
 	}
-	if !t.wk.used.CompareAndSwap(false, true) {
-		return ErrWorkerIsBeingUsed
+	if err := t.wk.acquire(); err != nil {
+		return err
 	}
-	defer t.wk.used.Store(false)
+	defer t.wk.release()
 	if t.ptr == 0 {
-		return ErrPointerIsNil
+		return ErrClosed
 	}
 	if pixmap.ptr == 0 {
-		return ErrPointerIsNil
+		return ErrClosed
 	}
 	rt, err := internal.ResvgTreeFromUsvg(t.wk.ctx, t.wk.mod, t.ptr)
 	if err != nil {
@@ -173,5 +476,129 @@ func (t *Tree) Render(transform transform, pixmap *Pixmap) error {
 		return err
 	}
 	defer internal.TinySkiaTransformDelete(t.wk.ctx, t.wk.mod, tf)
-	return internal.ResvgTreeRender(t.wk.ctx, t.wk.mod, rt, tf, pixmap.ptr)
+	t.wk.stats.renders.Add(1)
+	err = internal.ResvgTreeRender(t.wk.ctx, t.wk.mod, rt, tf, pixmap.ptr)
+	t.wk.readHeapStats()
+	return err
+}
+
+// HitTest returns the ids of the elements whose fill or stroke contains
+// the point (x, y) of a pixmap rendered with the transform, topmost first.
+// Elements without an id are reported by their nearest ancestor with an id.
+func (t *Tree) HitTest(x float32, y float32, transform transform) ([]NodeID, error) {
+	if err := t.wk.acquire(); err != nil {
+		return nil, err
+	}
+	defer t.wk.release()
+	if t.ptr == 0 {
+		return nil, ErrClosed
+	}
+	tf, err := transform(t.wk.ctx, t.wk.mod)
+	if err != nil {
+		return nil, err
+	}
+	defer internal.TinySkiaTransformDelete(t.wk.ctx, t.wk.mod, tf)
+	data, err := internal.UsvgTreeHitTest(t.wk.ctx, t.wk.mod, t.ptr, tf, x, y)
+	if err != nil {
+		return nil, err
+	}
+	var ids []NodeID
+	err = json.Unmarshal(data, &ids)
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// SetFill sets the fill color of the element and all of its descendants.
+func (t *Tree) SetFill(id NodeID, color Color) error {
+	if err := t.wk.acquire(); err != nil {
+		return err
+	}
+	defer t.wk.release()
+	if t.ptr == 0 {
+		return ErrClosed
+	}
+	return internal.UsvgTreeSetFill(t.wk.ctx, t.wk.mod, t.ptr, string(id), color.Red, color.Green, color.Blue)
+}
+
+// SetStroke sets the stroke color and width of the element and all of its descendants.
+func (t *Tree) SetStroke(id NodeID, color Color, width float32) error {
+	if err := t.wk.acquire(); err != nil {
+		return err
+	}
+	defer t.wk.release()
+	if t.ptr == 0 {
+		return ErrClosed
+	}
+	return internal.UsvgTreeSetStroke(t.wk.ctx, t.wk.mod, t.ptr, string(id), color.Red, color.Green, color.Blue, width)
+}
+
+// SetOpacity sets the opacity of the element, clamped to 0..1.
+// Groups get a group opacity, paths and texts get fill and stroke opacity.
+func (t *Tree) SetOpacity(id NodeID, opacity float32) error {
+	if err := t.wk.acquire(); err != nil {
+		return err
+	}
+	defer t.wk.release()
+	if t.ptr == 0 {
+		return ErrClosed
+	}
+	return internal.UsvgTreeSetOpacity(t.wk.ctx, t.wk.mod, t.ptr, string(id), opacity)
+}
+
+// NodeBBox returns the bounding box of the element in canvas coordinates,
+// strokes included. Text must be converted by `ConvertText` to be measured.
+func (t *Tree) NodeBBox(id NodeID) (Rect, error) {
+	if err := t.wk.acquire(); err != nil {
+		return Rect{}, err
+	}
+	defer t.wk.release()
+	if t.ptr == 0 {
+		return Rect{}, ErrClosed
+	}
+	data, err := internal.UsvgTreeNodeBBox(t.wk.ctx, t.wk.mod, t.ptr, string(id))
+	if err != nil {
+		return Rect{}, err
+	}
+	var rect Rect
+	err = json.Unmarshal(data, &rect)
+	return rect, err
+}
+
+// RetainNode removes all the elements but the element, its ancestors and descendants,
+// so that only the element is rendered, such as to export it.
+func (t *Tree) RetainNode(id NodeID) error {
+	if err := t.wk.acquire(); err != nil {
+		return err
+	}
+	defer t.wk.release()
+	if t.ptr == 0 {
+		return ErrClosed
+	}
+	return internal.UsvgTreeRetainNode(t.wk.ctx, t.wk.mod, t.ptr, string(id))
+}
+
+// SetVisible shows or hides the element and all of its descendants.
+func (t *Tree) SetVisible(id NodeID, visible bool) error {
+	if err := t.wk.acquire(); err != nil {
+		return err
+	}
+	defer t.wk.release()
+	if t.ptr == 0 {
+		return ErrClosed
+	}
+	return internal.UsvgTreeSetVisible(t.wk.ctx, t.wk.mod, t.ptr, string(id), visible)
+}
+
+// ReplaceColor replaces every solid fill and stroke of the color `from` with `to`.
+func (t *Tree) ReplaceColor(from Color, to Color) error {
+	if err := t.wk.acquire(); err != nil {
+		return err
+	}
+	defer t.wk.release()
+	if t.ptr == 0 {
+		return ErrClosed
+	}
+	return internal.UsvgTreeReplaceColor(t.wk.ctx, t.wk.mod, t.ptr, from.Red, from.Green, from.Blue, to.Red, to.Green, to.Blue)
 }
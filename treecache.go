@@ -0,0 +1,132 @@
+package resvg
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/json"
+)
+
+// TreeCache an LRU of the `Tree`s parsed by a `Worker`, keyed by the hash of
+// the SVG data, the options and the fonts of the text conversion, so that
+// rendering the same document again skips `NewTreeFromData`.
+// `TreeCache` are not goroutine-safe, as their `Worker`.
+type TreeCache struct {
+	wk      *Worker
+	size    int
+	lru     *list.List
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+// treeEntry an element of the lru.
+type treeEntry struct {
+	key    [sha256.Size]byte
+	tree   *Tree
+	report *TextConversionReport
+}
+
+// NewTreeCache new a cache of at most size `Tree`s of the `Worker`,
+// the least recently used `Tree` is closed when the cache is full.
+func (wk *Worker) NewTreeCache(size int) *TreeCache {
+	if size < 1 {
+		size = 1
+	}
+	return &TreeCache{
+		wk:      wk,
+		size:    size,
+		lru:     list.New(),
+		entries: make(map[[sha256.Size]byte]*list.Element),
+	}
+}
+
+// WithTreeCache gives the `Worker` a `TreeCache` of at most size `Tree`s,
+// returned by `Worker.TreeCache`, such as for the workers of a `Pool`.
+func WithTreeCache(size int) WorkerOption {
+	return func(wk *Worker) {
+		wk.trees = wk.NewTreeCache(size)
+	}
+}
+
+// TreeCache returns the `TreeCache` given by `WithTreeCache`, or nil.
+func (wk *Worker) TreeCache() *TreeCache {
+	return wk.trees
+}
+
+// Tree returns the `Tree` of the data parsed with the options and, unless the
+// fontdb is nil, text converted with the fontdb, parsing it on a miss.
+// The `Tree` belongs to the cache: it must not be closed or modified, `Clone` it
+// to modify, and it may be closed by the next call of `Tree`.
+func (c *TreeCache) Tree(data []byte, options *Options, fontdb *FontDB) (*Tree, error) {
+	tree, _, err := c.TreeReport(data, options, fontdb)
+	return tree, err
+}
+
+// TreeReport is like `Tree` and also returns the report of the text conversion,
+// kept with the `Tree`, or nil if the fontdb is nil.
+func (c *TreeCache) TreeReport(data []byte, options *Options, fontdb *FontDB) (*Tree, *TextConversionReport, error) {
+	key := treeKey(data, options, fontdb)
+	if e, ok := c.entries[key]; ok {
+		entry := e.Value.(*treeEntry)
+		if entry.tree.ptr != 0 {
+			c.lru.MoveToFront(e)
+			c.wk.stats.treeCacheHits.Add(1)
+			return entry.tree, entry.report, nil
+		}
+		// closed by mistake, parse it again
+		c.lru.Remove(e)
+		delete(c.entries, key)
+	}
+	c.wk.stats.treeCacheMisses.Add(1)
+	tree, err := c.wk.NewTreeFromData(data, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	var report *TextConversionReport
+	if fontdb != nil {
+		report, err = tree.ConvertText(fontdb)
+		if err != nil {
+			tree.Close()
+			return nil, nil, err
+		}
+	}
+	c.entries[key] = c.lru.PushFront(&treeEntry{key, tree, report})
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+	return tree, report, nil
+}
+
+// treeKey the hash of the data parsed with the options and text converted with the fontdb.
+func treeKey(data []byte, options *Options, fontdb *FontDB) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(data)
+	params, _ := json.Marshal(options)
+	h.Write(params)
+	if fontdb != nil {
+		h.Write([]byte("fonts:"))
+		h.Write(fontdb.fingerprint[:])
+	}
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+	return key
+}
+
+func (c *TreeCache) remove(e *list.Element) {
+	entry := e.Value.(*treeEntry)
+	c.lru.Remove(e)
+	delete(c.entries, entry.key)
+	if entry.tree.ptr != 0 {
+		entry.tree.Close()
+	}
+}
+
+// Len returns the number of `Tree`s in the cache.
+func (c *TreeCache) Len() int {
+	return c.lru.Len()
+}
+
+// Clear closes all the `Tree`s of the cache.
+func (c *TreeCache) Clear() {
+	for c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+}
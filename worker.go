@@ -7,7 +7,9 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/kanrichan/resvg-go/internal"
 	"github.com/tetratelabs/wazero"
@@ -22,17 +24,47 @@ type Worker struct {
 	r    wazero.Runtime
 	mod  api.Module
 	used *atomic.Bool
+	// closed the wasm module is torn down by `Close`.
+	closed *atomic.Bool
+	// mu guards pending, which is filled by finalizers on other goroutines,
+	// and heapErr, which is read by `Stats`.
+	mu      sync.Mutex
+	pending []pendingFree
+	heapErr error
+	stats   workerCounters
+	// acquired when the holder acquired the `Worker`.
+	acquired time.Time
+	observer Observer
+	// trees the cache given by `WithTreeCache`.
+	trees *TreeCache
+	// fontDirs the system font directories mounted into the wasm module.
+	fontDirs []fontMount
+}
+
+// handleKind the type of a wasm handle.
+type handleKind int
+
+const (
+	handleTree handleKind = iota
+	handlePixmap
+	handleFontDB
+)
+
+// pendingFree a handle whose wasm memory is freed at the next safe point.
+type pendingFree struct {
+	kind handleKind
+	ptr  int32
 }
 
 // NewDefaultWorker initialize a resvg wasm worker by default
 // `Worker` are not goroutine-safe!
-func NewDefaultWorker(ctx context.Context) (*Worker, error) {
-	return NewWorker(ctx, wazero.NewRuntimeConfig())
+func NewDefaultWorker(ctx context.Context, opts ...WorkerOption) (*Worker, error) {
+	return NewWorker(ctx, wazero.NewRuntimeConfig(), opts...)
 }
 
 // NewWorker initialize a resvg wasm worker with wazero.RuntimeConfig
 // `Worker` are not goroutine-safe!
-func NewWorker(ctx context.Context, config wazero.RuntimeConfig) (*Worker, error) {
+func NewWorker(ctx context.Context, config wazero.RuntimeConfig, opts ...WorkerOption) (*Worker, error) {
 	wasmgzr, err := gzip.NewReader(bytes.NewReader(internal.WasmGZ))
 	if err != nil {
 		return nil, err
@@ -47,22 +79,121 @@ func NewWorker(ctx context.Context, config wazero.RuntimeConfig) (*Worker, error
 
 	wasi_snapshot_preview1.MustInstantiate(ctx, r)
 
+	// the system font directories are mounted read-only at their own paths
+	// for `FontDB.LoadSystemFonts`, the other paths are of the current directory
+	fsConfig := wazero.NewFSConfig().WithFSMount(vfs{}, "/")
+	fontDirs := systemFontMounts()
+	for _, m := range fontDirs {
+		fsConfig = fsConfig.WithReadOnlyDirMount(m.dir, m.guest)
+	}
 	moduleConfig := wazero.NewModuleConfig().
 		WithStdout(os.Stdout).WithStderr(os.Stderr).
-		WithFS(vfs{})
+		WithFSConfig(fsConfig)
 
 	mod, err := r.InstantiateWithConfig(ctx, wasm, moduleConfig)
 	if err != nil {
 		return nil, err
 	}
-	return &Worker{ctx, r, mod, &atomic.Bool{}}, nil
+	wk := &Worker{ctx: ctx, r: r, mod: mod, used: &atomic.Bool{}, closed: &atomic.Bool{}, fontDirs: fontDirs}
+	for _, opt := range opts {
+		opt(wk)
+	}
+	return wk, nil
 }
 
-// Close cloes the `Worker`
+// Close cloes the `Worker`, its `Tree`, `Pixmap` and `FontDB`
+// return `ErrWorkerClosed` afterwards.
 func (wk *Worker) Close() error {
+	if err := wk.acquire(); err != nil {
+		return err
+	}
+	defer wk.release()
+	wk.closed.Store(true)
 	return wk.r.Close(wk.ctx)
 }
 
+// acquire marks the `Worker` as being used until `release`.
+func (wk *Worker) acquire() error {
+	if !wk.used.CompareAndSwap(false, true) {
+		return ErrWorkerIsBeingUsed
+	}
+	if wk.closed.Load() {
+		wk.used.Store(false)
+		return ErrWorkerClosed
+	}
+	wk.acquired = time.Now()
+	wk.freePending()
+	return nil
+}
+
+// track counts a new handle holding size bytes.
+func (wk *Worker) track(kind handleKind, size int64) {
+	switch kind {
+	case handleTree:
+		wk.stats.trees.Add(1)
+	case handlePixmap:
+		wk.stats.pixmaps.Add(1)
+		wk.stats.pixmapBytes.Add(size)
+	case handleFontDB:
+		wk.stats.fontdbs.Add(1)
+		wk.stats.fontBytes.Add(size)
+	}
+}
+
+// untrack uncounts a closed handle holding size bytes.
+func (wk *Worker) untrack(kind handleKind, size int64) {
+	switch kind {
+	case handleTree:
+		wk.stats.trees.Add(-1)
+	case handlePixmap:
+		wk.stats.pixmaps.Add(-1)
+		wk.stats.pixmapBytes.Add(-size)
+	case handleFontDB:
+		wk.stats.fontdbs.Add(-1)
+		wk.stats.fontBytes.Add(-size)
+	}
+}
+
+// finalize queues the wasm memory of a handle that was garbage collected
+// without `Close`, the wasm module can't be called from the finalizer goroutine.
+func (wk *Worker) finalize(kind handleKind, ptr int32, size int64) {
+	if ptr == 0 || wk.closed.Load() {
+		return
+	}
+	wk.untrack(kind, size)
+	wk.stats.finalized.Add(1)
+	wk.mu.Lock()
+	defer wk.mu.Unlock()
+	wk.pending = append(wk.pending, pendingFree{kind, ptr})
+}
+
+// freePending frees the handles queued by finalizers, the `Worker` must be acquired.
+func (wk *Worker) freePending() {
+	wk.mu.Lock()
+	pending := wk.pending
+	wk.pending = nil
+	wk.mu.Unlock()
+	for _, h := range pending {
+		switch h.kind {
+		case handleTree:
+			internal.UsvgTreeDelete(wk.ctx, wk.mod, h.ptr)
+		case handlePixmap:
+			internal.TinySkiaPixmapDelete(wk.ctx, wk.mod, h.ptr)
+		case handleFontDB:
+			internal.FontdbDatabaseDelete(wk.ctx, wk.mod, h.ptr)
+		}
+	}
+}
+
+// release updates the statistics and marks the `Worker` as unused.
+func (wk *Worker) release() {
+	wk.stats.wasmTime.Add(int64(time.Since(wk.acquired)))
+	if !wk.closed.Load() {
+		wk.stats.memorySize.Store(uint64(wk.mod.Memory().Size()))
+	}
+	wk.used.Store(false)
+}
+
 // vfs wasm mount directory
 type vfs struct{}
 